@@ -0,0 +1,91 @@
+// Copyright 2012 Matthew Endsley
+// All rights reserved
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted providing that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+// STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+// IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package goaws
+
+import (
+	"errors"
+	"strings"
+)
+
+// The components of an Amazon Resource Name of the form
+// "arn:<partition>:<service>:<region>:<account>:<resource>".
+type ARN struct {
+	Partition string
+	Service   string
+	Region    string
+	AccountId string
+
+	// Resource part of the ARN, e.g. a queue or topic name. May itself
+	// contain colons, as in SNS subscription ARNs.
+	Resource string
+}
+
+// Parse an ARN into its components.
+func ParseARN(arn string) (ARN, error) {
+
+	parts := strings.SplitN(arn, ":", 6)
+	if len(parts) != 6 || parts[0] != "arn" || parts[1] == "" || parts[2] == "" || parts[5] == "" {
+		return ARN{}, errors.New("Malformed ARN: " + arn)
+	}
+
+	return ARN{
+		Partition: parts[1],
+		Service:   parts[2],
+		Region:    parts[3],
+		AccountId: parts[4],
+		Resource:  parts[5],
+	}, nil
+}
+
+// Format the ARN.
+func (a ARN) String() string {
+	return "arn:" + a.Partition + ":" + a.Service + ":" + a.Region + ":" + a.AccountId + ":" + a.Resource
+}
+
+// Get the partition a region belongs to.
+func partitionForRegion(region string) string {
+	switch {
+	case strings.HasPrefix(region, "cn-"):
+		return "aws-cn"
+	case strings.HasPrefix(region, "us-gov-"):
+		return "aws-us-gov"
+	case strings.HasPrefix(region, "us-isob-"):
+		return "aws-iso-b"
+	case strings.HasPrefix(region, "us-iso-"):
+		return "aws-iso"
+	}
+
+	return "aws"
+}
+
+// Get the ARN of an SQS queue, e.g. for a redrive or access policy.
+func QueueARN(region, accountId, name string) string {
+	return ARN{Partition: partitionForRegion(region), Service: "sqs", Region: region, AccountId: accountId, Resource: name}.String()
+}
+
+// Get the ARN of an SNS topic.
+func TopicARN(region, accountId, name string) string {
+	return ARN{Partition: partitionForRegion(region), Service: "sns", Region: region, AccountId: accountId, Resource: name}.String()
+}
@@ -0,0 +1,200 @@
+// Copyright 2012 Matthew Endsley
+// All rights reserved
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted providing that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+// STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+// IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package goaws
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Get the hex encoded MD5 digest of a message body.
+func md5Hex(body string) string {
+	sum := md5.Sum([]byte(body))
+	return hex.EncodeToString(sum[:])
+}
+
+// A typed value attached to an SQS or SNS message.
+type MessageAttribute struct {
+	// One of "String", "Number" or "Binary", optionally followed by
+	// a custom type suffix (e.g. "Number.float").
+	DataType    string
+	StringValue string
+	BinaryValue []byte
+}
+
+// A set of message attributes keyed by attribute name.
+type MessageAttributes map[string]MessageAttribute
+
+// Set a string attribute.
+func (a MessageAttributes) SetString(name, value string) {
+	a[name] = MessageAttribute{
+		DataType:    "String",
+		StringValue: value,
+	}
+}
+
+// Set a numeric attribute.
+func (a MessageAttributes) SetNumber(name string, n float64) {
+	a[name] = MessageAttribute{
+		DataType:    "Number",
+		StringValue: strconv.FormatFloat(n, 'f', -1, 64),
+	}
+}
+
+// Set a binary attribute.
+func (a MessageAttributes) SetBinary(name string, b []byte) {
+	a[name] = MessageAttribute{
+		DataType:    "Binary",
+		BinaryValue: b,
+	}
+}
+
+// Is the attribute's data type binary (including custom binary types)?
+func (attr MessageAttribute) isBinary() bool {
+	return attr.DataType == "Binary" || strings.HasPrefix(attr.DataType, "Binary.")
+}
+
+// Get the size the attributes count towards a message's size limit:
+// the bytes of each attribute's name, data type and value.
+func (a MessageAttributes) size() int {
+	size := 0
+	for name, attr := range a {
+		size += len(name) + len(attr.DataType) + len(attr.StringValue) + len(attr.BinaryValue)
+	}
+
+	return size
+}
+
+// Flatten the attributes into request parameters. `prefix` is the
+// service specific parameter prefix, e.g. "MessageAttribute" for SQS.
+// Attributes are emitted in name order.
+func (a MessageAttributes) encode(params url.Values, prefix string) {
+
+	names := make([]string, 0, len(a))
+	for name := range a {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for ii, name := range names {
+		attr := a[name]
+		entry := prefix + "." + strconv.Itoa(ii+1)
+		params.Set(entry+".Name", name)
+		params.Set(entry+".Value.DataType", attr.DataType)
+		if attr.isBinary() {
+			params.Set(entry+".Value.BinaryValue", base64.StdEncoding.EncodeToString(attr.BinaryValue))
+		} else {
+			params.Set(entry+".Value.StringValue", attr.StringValue)
+		}
+	}
+}
+
+// Get the hex encoded MD5 digest of the attributes, computed the way
+// SQS computes MD5OfMessageAttributes: for each attribute in name
+// order, the name, data type and value are each written as a 4 byte
+// big-endian length followed by the bytes, with a transport type byte
+// (1 for string and number values, 2 for binary values) between the
+// data type and the value. Returns an empty string for no attributes.
+func (a MessageAttributes) md5() string {
+
+	if len(a) == 0 {
+		return ""
+	}
+
+	names := make([]string, 0, len(a))
+	for name := range a {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	h := md5.New()
+	writeField := func(b []byte) {
+		var length [4]byte
+		binary.BigEndian.PutUint32(length[:], uint32(len(b)))
+		h.Write(length[:])
+		h.Write(b)
+	}
+
+	for _, name := range names {
+		attr := a[name]
+		writeField([]byte(name))
+		writeField([]byte(attr.DataType))
+		if attr.isBinary() {
+			h.Write([]byte{2})
+			writeField(attr.BinaryValue)
+		} else {
+			h.Write([]byte{1})
+			writeField([]byte(attr.StringValue))
+		}
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Wire format of a message attribute in a response.
+type messageAttributeXML struct {
+	Name  string
+	Value struct {
+		DataType    string
+		StringValue string
+		BinaryValue string
+	}
+}
+
+// Parse message attributes from a response.
+func parseMessageAttributes(entries []messageAttributeXML) (MessageAttributes, error) {
+
+	if len(entries) == 0 {
+		return nil, nil
+	}
+
+	attrs := make(MessageAttributes, len(entries))
+	for _, entry := range entries {
+		attr := MessageAttribute{
+			DataType:    entry.Value.DataType,
+			StringValue: entry.Value.StringValue,
+		}
+
+		if attr.isBinary() {
+			b, err := base64.StdEncoding.DecodeString(entry.Value.BinaryValue)
+			if err != nil {
+				return nil, errors.New("Malformed binary attribute " + entry.Name + ": " + err.Error())
+			}
+			attr.BinaryValue = b
+			attr.StringValue = ""
+		}
+
+		attrs[entry.Name] = attr
+	}
+
+	return attrs, nil
+}
@@ -0,0 +1,152 @@
+// Copyright 2012 Matthew Endsley
+// All rights reserved
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted providing that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+// STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+// IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package goaws
+
+import (
+	"encoding/xml"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestMessageAttributesEncode(t *testing.T) {
+
+	attrs := MessageAttributes{}
+	attrs.SetString("color", "blue")
+	attrs.SetNumber("count", 42)
+	attrs.SetBinary("data", []byte{0, 1, 2, 255})
+	attrs["image"] = MessageAttribute{DataType: "Binary.gif", BinaryValue: []byte("GIF89a")}
+	attrs["price"] = MessageAttribute{DataType: "Number.float", StringValue: "1.5"}
+
+	params := make(url.Values)
+	attrs.encode(params, "MessageAttribute")
+
+	want := url.Values{
+		"MessageAttribute.1.Name":              {"color"},
+		"MessageAttribute.1.Value.DataType":    {"String"},
+		"MessageAttribute.1.Value.StringValue": {"blue"},
+		"MessageAttribute.2.Name":              {"count"},
+		"MessageAttribute.2.Value.DataType":    {"Number"},
+		"MessageAttribute.2.Value.StringValue": {"42"},
+		"MessageAttribute.3.Name":              {"data"},
+		"MessageAttribute.3.Value.DataType":    {"Binary"},
+		"MessageAttribute.3.Value.BinaryValue": {"AAEC/w=="},
+		"MessageAttribute.4.Name":              {"image"},
+		"MessageAttribute.4.Value.DataType":    {"Binary.gif"},
+		"MessageAttribute.4.Value.BinaryValue": {"R0lGODlh"},
+		"MessageAttribute.5.Name":              {"price"},
+		"MessageAttribute.5.Value.DataType":    {"Number.float"},
+		"MessageAttribute.5.Value.StringValue": {"1.5"},
+	}
+	if !reflect.DeepEqual(params, want) {
+		t.Errorf("encode() = %v, want %v", params, want)
+	}
+}
+
+func TestParseMessageAttributes(t *testing.T) {
+
+	tests := []struct {
+		name string
+		xml  string
+		want MessageAttributes
+		err  bool
+	}{
+		{"none", ``, nil, false},
+		{"string", `<MessageAttribute><Name>color</Name><Value><DataType>String</DataType><StringValue>blue</StringValue></Value></MessageAttribute>`,
+			MessageAttributes{"color": {DataType: "String", StringValue: "blue"}}, false},
+		{"custom number", `<MessageAttribute><Name>price</Name><Value><DataType>Number.float</DataType><StringValue>1.5</StringValue></Value></MessageAttribute>`,
+			MessageAttributes{"price": {DataType: "Number.float", StringValue: "1.5"}}, false},
+		{"binary", `<MessageAttribute><Name>data</Name><Value><DataType>Binary</DataType><BinaryValue>AAEC/w==</BinaryValue></Value></MessageAttribute>`,
+			MessageAttributes{"data": {DataType: "Binary", BinaryValue: []byte{0, 1, 2, 255}}}, false},
+		{"custom binary", `<MessageAttribute><Name>image</Name><Value><DataType>Binary.gif</DataType><BinaryValue>R0lGODlh</BinaryValue></Value></MessageAttribute>`,
+			MessageAttributes{"image": {DataType: "Binary.gif", BinaryValue: []byte("GIF89a")}}, false},
+		{"malformed binary", `<MessageAttribute><Name>data</Name><Value><DataType>Binary</DataType><BinaryValue>not base64!</BinaryValue></Value></MessageAttribute>`,
+			nil, true},
+	}
+
+	for _, tt := range tests {
+		var message struct {
+			MessageAttribute []messageAttributeXML
+		}
+		if err := xml.Unmarshal([]byte("<Message>"+tt.xml+"</Message>"), &message); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+
+		got, err := parseMessageAttributes(message.MessageAttribute)
+		if tt.err {
+			if err == nil {
+				t.Errorf("%s: attributes = %v, want an error", tt.name, got)
+			}
+		} else if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+		} else if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: attributes = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestMessageAttributesMD5(t *testing.T) {
+
+	// Digests computed independently from the algorithm documented for
+	// MD5OfMessageAttributes
+	binary := []byte{0, 1, 2, 255}
+	tests := []struct {
+		name  string
+		attrs MessageAttributes
+		want  string
+	}{
+		{"none", nil, ""},
+		{"string", MessageAttributes{"color": {DataType: "String", StringValue: "blue"}}, "da1b33cc3cbfe8b1630921e78e6b9880"},
+		{"number", MessageAttributes{"count": {DataType: "Number", StringValue: "42"}}, "2ee5fa915753ff72599b2514463a2897"},
+		{"binary", MessageAttributes{"data": {DataType: "Binary", BinaryValue: binary}}, "a00d04c436d0bd8e7f21d1c925447204"},
+		{"custom string", MessageAttributes{"color": {DataType: "String.rgb", StringValue: "0000ff"}}, "08ecbcf7b1af37ca0a92f1a0e2e5ca9f"},
+		{"custom number", MessageAttributes{"price": {DataType: "Number.float", StringValue: "1.5"}}, "fb788a366da50b1e572d7a375bf69198"},
+		{"custom binary", MessageAttributes{"image": {DataType: "Binary.gif", BinaryValue: []byte("GIF89a")}}, "91f85fa7b3bfeca7c170ab85aac75001"},
+		{"empty string", MessageAttributes{"e": {DataType: "String"}}, "6bc73efe9a52418a9ef9300a04f7287d"},
+		{"multibyte string", MessageAttributes{"name": {DataType: "String", StringValue: "héllo"}}, "2a74c928eb7620ad8dc6bac54338bed1"},
+		{"mixed", MessageAttributes{
+			"color": {DataType: "String", StringValue: "blue"},
+			"count": {DataType: "Number", StringValue: "42"},
+			"data":  {DataType: "Binary", BinaryValue: binary},
+			"image": {DataType: "Binary.gif", BinaryValue: []byte("GIF89a")},
+		}, "86e471ad462d4b3bb25608644ae952d4"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.attrs.md5(); got != tt.want {
+			t.Errorf("%s: md5() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	// the setters produce the same attributes
+	attrs := MessageAttributes{}
+	attrs.SetString("color", "blue")
+	attrs.SetNumber("count", 42)
+	attrs.SetBinary("data", binary)
+	attrs["image"] = MessageAttribute{DataType: "Binary.gif", BinaryValue: []byte("GIF89a")}
+	if got := attrs.md5(); got != "86e471ad462d4b3bb25608644ae952d4" {
+		t.Errorf("setters: md5() = %q, want %q", got, "86e471ad462d4b3bb25608644ae952d4")
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright 2012 Matthew Endsley
+// All rights reserved
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted providing that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+// STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+// IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package goaws
+
+import (
+	"net/url"
+	"time"
+)
+
+// A record of a signed request, suitable for an audit log. Records
+// never contain secrets: the signature and session token are left out.
+type AuditRecord struct {
+	// Time the request was signed.
+	Time time.Time
+
+	Method string
+	Host   string
+	Path   string
+
+	// Canonical query string of the signed parameters, sorted as for
+	// signing, without the signature or session token.
+	Query string
+}
+
+// Parameters left out of audit records.
+var auditExcludedParams = []string{
+	"Signature",
+	"signature",
+	"SecurityToken",
+}
+
+// Create an audit record for a request about to be signed.
+func newAuditRecord(method, host, path string, params url.Values) AuditRecord {
+
+	audited := make(url.Values, len(params))
+	for key, values := range params {
+		audited[key] = values
+	}
+	for _, key := range auditExcludedParams {
+		audited.Del(key)
+	}
+
+	return AuditRecord{
+		Time:   time.Now().UTC(),
+		Method: method,
+		Host:   host,
+		Path:   path,
+		Query:  canonicalQuery(audited),
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright 2012 Matthew Endsley
+// All rights reserved
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted providing that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+// STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+// IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package goaws
+
+import (
+	"container/list"
+	"time"
+)
+
+// Default settings for the in-memory caches.
+const (
+	defaultCacheTTL        = 5 * time.Minute
+	defaultCacheMaxEntries = 10000
+)
+
+// A bounded map whose entries expire after a TTL. When full, the least
+// recently used entry is evicted. Not safe for concurrent use.
+type ttlCache[V any] struct {
+	ttl        time.Duration
+	maxEntries int
+
+	entries map[string]*list.Element
+	lru     *list.List
+}
+
+type ttlCacheEntry[V any] struct {
+	key     string
+	value   V
+	expires time.Time
+}
+
+// Create a cache. Zero values use the default TTL and size.
+func newTTLCache[V any](ttl time.Duration, maxEntries int) *ttlCache[V] {
+	if ttl <= 0 {
+		ttl = defaultCacheTTL
+	}
+	if maxEntries <= 0 {
+		maxEntries = defaultCacheMaxEntries
+	}
+
+	return &ttlCache[V]{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		entries:    make(map[string]*list.Element),
+		lru:        list.New(),
+	}
+}
+
+// Get the value of an unexpired entry, marking it recently used.
+func (tc *ttlCache[V]) get(key string) (V, bool) {
+
+	e, ok := tc.entries[key]
+	if !ok {
+		var zero V
+		return zero, false
+	}
+
+	entry := e.Value.(*ttlCacheEntry[V])
+	if !time.Now().Before(entry.expires) {
+		tc.removeElement(e)
+		var zero V
+		return zero, false
+	}
+
+	tc.lru.MoveToFront(e)
+	return entry.value, true
+}
+
+// Set the value of an entry, which expires one TTL from now.
+func (tc *ttlCache[V]) put(key string, value V) {
+
+	expires := time.Now().Add(tc.ttl)
+	if e, ok := tc.entries[key]; ok {
+		entry := e.Value.(*ttlCacheEntry[V])
+		entry.value = value
+		entry.expires = expires
+		tc.lru.MoveToFront(e)
+		return
+	}
+
+	for tc.lru.Len() >= tc.maxEntries {
+		tc.removeElement(tc.lru.Back())
+	}
+
+	tc.entries[key] = tc.lru.PushFront(&ttlCacheEntry[V]{key: key, value: value, expires: expires})
+}
+
+// Remove an entry, if present.
+func (tc *ttlCache[V]) remove(key string) {
+	if e, ok := tc.entries[key]; ok {
+		tc.removeElement(e)
+	}
+}
+
+func (tc *ttlCache[V]) removeElement(e *list.Element) {
+	tc.lru.Remove(e)
+	delete(tc.entries, e.Value.(*ttlCacheEntry[V]).key)
+}
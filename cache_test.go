@@ -0,0 +1,82 @@
+// Copyright 2012 Matthew Endsley
+// All rights reserved
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted providing that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+// STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+// IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package goaws
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTTLCacheEvictsLeastRecentlyUsed(t *testing.T) {
+
+	tc := newTTLCache[int](time.Minute, 2)
+	tc.put("a", 1)
+	tc.put("b", 2)
+	tc.get("a")
+	tc.put("c", 3)
+
+	tests := []struct {
+		key     string
+		present bool
+	}{
+		{"a", true},
+		{"b", false},
+		{"c", true},
+	}
+
+	for _, tt := range tests {
+		if _, ok := tc.get(tt.key); ok != tt.present {
+			t.Errorf("%s: present = %v, want %v", tt.key, ok, tt.present)
+		}
+	}
+}
+
+func TestTTLCacheExpires(t *testing.T) {
+
+	tc := newTTLCache[int](10*time.Millisecond, 0)
+	tc.put("a", 1)
+	if v, ok := tc.get("a"); !ok || v != 1 {
+		t.Fatalf("get = %v, %v", v, ok)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	if _, ok := tc.get("a"); ok {
+		t.Error("Expired entry returned")
+	}
+	if len(tc.entries) != 0 {
+		t.Error("Expired entry not removed")
+	}
+}
+
+func TestPublishCacheKeepsFirstResult(t *testing.T) {
+
+	pc := NewPublishCache(0, 0)
+	pc.put("key", PublishResult{MessageId: "first"})
+	pc.put("key", PublishResult{MessageId: "second"})
+
+	if result, ok := pc.get("key"); !ok || result.MessageId != "first" {
+		t.Errorf("get = %+v, %v", result, ok)
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright 2012 Matthew Endsley
+// All rights reserved
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted providing that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+// STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+// IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package goaws
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// Returned by receives interrupted through a PollCanceller.
+var ErrPollCancelled = errors.New("Poll cancelled")
+
+// A handle for interrupting receives from another goroutine, e.g. to
+// reconfigure a consumer without waiting for a long poll to finish.
+// Set it as ReceiveOptions.Canceller. The zero value is ready to use,
+// and a PollCanceller must not be copied after first use.
+type PollCanceller struct {
+	mu        sync.Mutex
+	cancelled chan struct{}
+}
+
+// Abort every receive currently in flight through the canceller. They
+// return ErrPollCancelled. Receives started afterwards are unaffected.
+func (p *PollCanceller) Cancel() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.cancelled != nil {
+		close(p.cancelled)
+		p.cancelled = nil
+	}
+}
+
+// Derive a context from `ctx` that is cancelled along with the
+// receives in flight. `cancelled` reports whether Cancel was called;
+// `stop` must be called once the receive is done.
+func (p *PollCanceller) watch(ctx context.Context) (watched context.Context, cancelled func() bool, stop func()) {
+
+	p.mu.Lock()
+	if p.cancelled == nil {
+		p.cancelled = make(chan struct{})
+	}
+	ch := p.cancelled
+	p.mu.Unlock()
+
+	watched, cancel := context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-ch:
+			cancel()
+		case <-watched.Done():
+		}
+	}()
+
+	cancelled = func() bool {
+		select {
+		case <-ch:
+			return true
+		default:
+			return false
+		}
+	}
+
+	return watched, cancelled, cancel
+}
@@ -0,0 +1,295 @@
+// Copyright 2012 Matthew Endsley
+// All rights reserved
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted providing that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+// STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+// IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package goaws
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Signing certificates already fetched and verified, keyed by host and
+// path. Only URLs on allowed hosts are cached, and the cache is emptied
+// when full, so URLs supplied by third parties can't grow it without
+// bound.
+var certificateCache struct {
+	sync.Mutex
+	certs map[string]*x509.Certificate
+}
+
+// Maximum number of cached signing certificates.
+const maxCachedCertificates = 64
+
+// Roots signing certificates must chain to. The system roots if nil.
+var certificateRoots *x509.CertPool
+
+// Maximum number of intermediate certificates fetched from a
+// certificate's issuer URL while building its chain.
+const maxFetchedIntermediates = 3
+
+// Hosts of SNS regional endpoints.
+var snsHostPattern = regexp.MustCompile(`^sns\.[a-z0-9-]+\.amazonaws\.com(\.cn)?$`)
+
+// Paths of SNS signing certificates.
+var snsCertificatePathPattern = regexp.MustCompile(`^/SimpleNotificationService-[0-9A-Za-z]+\.pem$`)
+
+// Check that a URL received from a third party (such as the sender of
+// a notification) is served over HTTPS by an SNS regional endpoint, so
+// it is safe to fetch. Returns the URL's host.
+func validateSNSURL(what, rawURL string) (string, error) {
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", errors.New("Malformed " + strings.ToLower(what) + " URL: " + err.Error())
+	}
+
+	if u.Scheme != "https" {
+		return "", errors.New(what + " URL must use https: " + rawURL)
+	}
+
+	host := strings.ToLower(u.Host)
+	if !snsHostPattern.MatchString(host) {
+		return "", errors.New(what + " URL is not an SNS host: " + rawURL)
+	}
+
+	return host, nil
+}
+
+// Fetch (or retrieve from cache) the SNS signing certificate at a
+// SigningCertURL.
+func fetchSNSCertificate(c Context, certURL string) (*x509.Certificate, error) {
+
+	host, err := validateSNSURL("Certificate", certURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if u, _ := url.Parse(certURL); !snsCertificatePathPattern.MatchString(u.Path) || u.RawQuery != "" {
+		return nil, errors.New("Certificate URL is not an SNS signing certificate: " + certURL)
+	}
+
+	// SNS certificates are issued to sns.amazonaws.com rather than to
+	// each regional host
+	name := "sns.amazonaws.com"
+	if strings.HasSuffix(host, ".cn") {
+		name += ".cn"
+	}
+
+	return fetchCertificate(c, certURL, name, host)
+}
+
+// Hosts serving FPS signing certificates.
+var fpsCertificateHosts = map[string]bool{
+	"fps.amazonaws.com":         true,
+	"fps.sandbox.amazonaws.com": true,
+}
+
+// Fetch (or retrieve from cache) the FPS signing certificate at a
+// certificateUrl.
+func fetchFPSCertificate(c Context, certURL string) (*x509.Certificate, error) {
+
+	u, err := url.Parse(certURL)
+	if err != nil {
+		return nil, errors.New("Malformed certificate URL: " + err.Error())
+	}
+
+	if u.Scheme != "https" {
+		return nil, errors.New("Certificate URL must use https: " + certURL)
+	}
+
+	host := strings.ToLower(u.Host)
+	if !fpsCertificateHosts[host] || !strings.HasPrefix(u.Path, "/certs/") || !strings.HasSuffix(u.Path, ".pem") {
+		return nil, errors.New("Certificate URL is not an FPS signing certificate: " + certURL)
+	}
+
+	return fetchCertificate(c, certURL, host)
+}
+
+// Fetch (or retrieve from cache) an Amazon signing certificate from a
+// URL already checked to be served by Amazon. The certificate must
+// chain to a trusted root and be issued to one of `names`.
+func fetchCertificate(c Context, certURL string, names ...string) (*x509.Certificate, error) {
+
+	u, err := url.Parse(certURL)
+	if err != nil {
+		return nil, errors.New("Malformed certificate URL: " + err.Error())
+	}
+	key := strings.ToLower(u.Host) + u.Path
+
+	certificateCache.Lock()
+	cert, ok := certificateCache.certs[key]
+	certificateCache.Unlock()
+	if ok {
+		return cert, nil
+	}
+
+	data, err := fetchCertificateData(c, certURL)
+	if err != nil {
+		return nil, err
+	}
+
+	certs, err := parseCertificates(data)
+	if err != nil {
+		return nil, err
+	} else if len(certs) == 0 {
+		return nil, errors.New("Malformed certificate: no certificate data")
+	}
+
+	cert = certs[0]
+	if err := verifyCertificate(c, cert, certs[1:], names); err != nil {
+		return nil, err
+	}
+
+	certificateCache.Lock()
+	if certificateCache.certs == nil || len(certificateCache.certs) >= maxCachedCertificates {
+		certificateCache.certs = make(map[string]*x509.Certificate)
+	}
+	certificateCache.certs[key] = cert
+	certificateCache.Unlock()
+
+	return cert, nil
+}
+
+// Download a certificate file.
+func fetchCertificateData(c Context, certURL string) ([]byte, error) {
+
+	req, err := http.NewRequest("GET", certURL, nil)
+	if err != nil {
+		return nil, errors.New("Failed to create request: " + err.Error())
+	}
+
+	resp, err := c.do(req, 0)
+	if err != nil {
+		return nil, errors.New("Failed to fetch certificate: " + err.Error())
+	}
+
+	defer closeBody(resp)
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New("Failed to fetch certificate: " + resp.Status)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.New("Failed to fetch certificate: " + err.Error())
+	}
+
+	return data, nil
+}
+
+// Parse the certificates in PEM data, or a single DER certificate as
+// served from issuer URLs.
+func parseCertificates(data []byte) ([]*x509.Certificate, error) {
+
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, errors.New("Malformed certificate: " + err.Error())
+		}
+		certs = append(certs, cert)
+	}
+
+	if len(certs) == 0 && len(data) > 0 {
+		cert, err := x509.ParseCertificate(data)
+		if err != nil {
+			return nil, errors.New("Malformed certificate: " + err.Error())
+		}
+		certs = append(certs, cert)
+	}
+
+	return certs, nil
+}
+
+// Check that a certificate chains to a trusted root and is issued to
+// one of `names`. Intermediates missing from `intermediates` are
+// fetched from the issuer URLs of the certificates, as signing
+// certificates are often served without their chain.
+func verifyCertificate(c Context, cert *x509.Certificate, intermediates []*x509.Certificate, names []string) error {
+
+	named := false
+	for _, name := range names {
+		if cert.VerifyHostname(name) == nil || strings.EqualFold(cert.Subject.CommonName, name) {
+			named = true
+			break
+		}
+	}
+	if !named {
+		return errors.New("Certificate is not issued to " + strings.Join(names, " or ") + ": " + cert.Subject.CommonName)
+	}
+
+	pool := x509.NewCertPool()
+	for _, intermediate := range intermediates {
+		pool.AddCert(intermediate)
+	}
+
+	opts := x509.VerifyOptions{
+		Roots:         certificateRoots,
+		Intermediates: pool,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}
+
+	issuer := cert
+	for fetched := 0; ; fetched++ {
+		_, err := cert.Verify(opts)
+		if err == nil {
+			return nil
+		}
+
+		var unknown x509.UnknownAuthorityError
+		if !errors.As(err, &unknown) || fetched == maxFetchedIntermediates || len(issuer.IssuingCertificateURL) == 0 {
+			return errors.New("Untrusted certificate: " + err.Error())
+		}
+
+		data, err := fetchCertificateData(c, issuer.IssuingCertificateURL[0])
+		if err != nil {
+			return err
+		}
+
+		certs, err := parseCertificates(data)
+		if err != nil || len(certs) == 0 {
+			return errors.New("Malformed issuer certificate: " + issuer.IssuingCertificateURL[0])
+		}
+
+		issuer = certs[0]
+		pool.AddCert(issuer)
+	}
+}
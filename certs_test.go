@@ -0,0 +1,232 @@
+// Copyright 2012 Matthew Endsley
+// All rights reserved
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted providing that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+// STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+// IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package goaws
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// A certificate and key issued for tests.
+type testCert struct {
+	cert *x509.Certificate
+	key  *rsa.PrivateKey
+}
+
+var testSerial int64
+
+// Issue a test certificate for `name`, signed by `parent` (self-signed
+// if nil). `issuerURL` is set as the certificate's issuer URL.
+func newTestCert(t *testing.T, name string, isCA bool, parent *testCert, issuerURL string) *testCert {
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testSerial++
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(testSerial),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+	}
+	if !isCA {
+		template.DNSNames = []string{name}
+	}
+	if issuerURL != "" {
+		template.IssuingCertificateURL = []string{issuerURL}
+	}
+
+	signer, signerKey := template, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &testCert{cert: cert, key: key}
+}
+
+// PEM encoding of the certificate.
+func (c *testCert) pem() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw})
+}
+
+// A transport calling a function for each request.
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+// A transport serving fixed responses by URL, and 404 for other URLs.
+type staticTransport map[string][]byte
+
+func (st staticTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	body, ok := st[r.URL.String()]
+	status := http.StatusOK
+	if !ok {
+		status = http.StatusNotFound
+	}
+
+	return &http.Response{
+		StatusCode: status,
+		Status:     strconv.Itoa(status) + " " + http.StatusText(status),
+		Header:     make(http.Header),
+		Body:       io.NopCloser(bytes.NewReader(body)),
+		Request:    r,
+	}, nil
+}
+
+// A trusted test root, with an intermediate served from its issuer URL.
+type testPKI struct {
+	root         *testCert
+	intermediate *testCert
+	transport    staticTransport
+}
+
+const testIntermediateURL = "http://crt.example.com/intermediate.cer"
+
+func newTestPKI(t *testing.T) *testPKI {
+
+	root := newTestCert(t, "Test Root", true, nil, "")
+	intermediate := newTestCert(t, "Test Intermediate", true, root, "")
+
+	roots := x509.NewCertPool()
+	roots.AddCert(root.cert)
+	certificateRoots = roots
+	t.Cleanup(func() {
+		certificateRoots = nil
+		resetCertificateCache()
+	})
+	resetCertificateCache()
+
+	return &testPKI{
+		root:         root,
+		intermediate: intermediate,
+		transport:    staticTransport{testIntermediateURL: intermediate.cert.Raw},
+	}
+}
+
+func resetCertificateCache() {
+	certificateCache.Lock()
+	certificateCache.certs = nil
+	certificateCache.Unlock()
+}
+
+func TestFetchFPSCertificate(t *testing.T) {
+
+	pki := newTestPKI(t)
+	leaf := newTestCert(t, "fps.amazonaws.com", false, pki.intermediate, testIntermediateURL)
+	sandbox := newTestCert(t, "fps.sandbox.amazonaws.com", false, pki.intermediate, testIntermediateURL)
+	selfSigned := newTestCert(t, "fps.amazonaws.com", false, nil, "")
+
+	pki.transport["https://fps.amazonaws.com/certs/090911/PKICert.pem"] = leaf.pem()
+	pki.transport["https://fps.sandbox.amazonaws.com/certs/090911/PKICert.pem"] = sandbox.pem()
+	pki.transport["https://fps.amazonaws.com/certs/bundled/PKICert.pem"] = append(leaf.pem(), pki.intermediate.pem()...)
+	pki.transport["https://fps.amazonaws.com/certs/self/PKICert.pem"] = selfSigned.pem()
+	pki.transport["https://fps.amazonaws.com/certs/wrongname/PKICert.pem"] = sandbox.pem()
+	pki.transport["https://attacker.s3.amazonaws.com/certs/090911/PKICert.pem"] = leaf.pem()
+
+	c := NewContext("id", "key")
+	c.Transport = pki.transport
+
+	tests := []struct {
+		url   string
+		valid bool
+	}{
+		{"https://fps.amazonaws.com/certs/090911/PKICert.pem", true},
+		{"https://fps.sandbox.amazonaws.com/certs/090911/PKICert.pem", true},
+		{"https://fps.amazonaws.com/certs/bundled/PKICert.pem", true},
+		{"https://fps.amazonaws.com/certs/self/PKICert.pem", false},
+		{"https://fps.amazonaws.com/certs/wrongname/PKICert.pem", false},
+		{"https://attacker.s3.amazonaws.com/certs/090911/PKICert.pem", false},
+		{"http://fps.amazonaws.com/certs/090911/PKICert.pem", false},
+		{"https://fps.amazonaws.com/other/PKICert.pem", false},
+	}
+
+	for _, tt := range tests {
+		cert, err := fetchFPSCertificate(c, tt.url)
+		if tt.valid && (err != nil || cert == nil) {
+			t.Errorf("%s: unexpected error: %v", tt.url, err)
+		} else if !tt.valid && err == nil {
+			t.Errorf("%s: accepted", tt.url)
+		}
+	}
+}
+
+func TestCertificateCacheBounded(t *testing.T) {
+
+	pki := newTestPKI(t)
+	leaf := newTestCert(t, "fps.amazonaws.com", false, pki.intermediate, testIntermediateURL)
+
+	c := NewContext("id", "key")
+	c.Transport = pki.transport
+	for ii := 0; ii < 2*maxCachedCertificates; ii++ {
+		// queries are ignored by the cache
+		certURL := "https://fps.amazonaws.com/certs/" + strconv.Itoa(ii) + "/PKICert.pem?requestId=" + strconv.Itoa(ii)
+		pki.transport[certURL] = leaf.pem()
+
+		if _, err := fetchFPSCertificate(c, certURL); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	certificateCache.Lock()
+	n := len(certificateCache.certs)
+	for key := range certificateCache.certs {
+		if strings.Contains(key, "?") {
+			t.Errorf("Cache keyed on query: %s", key)
+		}
+	}
+	certificateCache.Unlock()
+
+	if n > maxCachedCertificates {
+		t.Errorf("Cache holds %d certificates, more than %d", n, maxCachedCertificates)
+	}
+}
@@ -0,0 +1,443 @@
+// Copyright 2012 Matthew Endsley
+// All rights reserved
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted providing that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+// STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+// IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package goaws
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Returned by Consume when handlers did not finish within the drain
+// timeout after shutdown.
+var ErrDrainTimeout = errors.New("Timed out waiting for handlers to finish")
+
+// Options controlling Queue.Consume.
+type ConsumeOptions struct {
+	// Options used for each receive. Receives long poll for Wait (20
+	// seconds if zero) unless Mode is ShortPoll, in which case empty
+	// polls are followed by a short, increasing delay. A zero
+	// MaxMessages receives up to MaxReceiveMessages messages.
+	Receive ReceiveOptions
+
+	// Number of messages handled concurrently. Defaults to 1.
+	Concurrency int
+
+	// Maximum number of received messages waiting for a free handler.
+	// Pollers stop receiving while the buffer is full, and never
+	// receive more messages than there is room for, so messages don't
+	// use up their visibility timeout in a backlog. Zero buffers up to
+	// one receive's worth of messages.
+	BufferSize int
+
+	// Number of receive loops polling the queue concurrently. Defaults
+	// to 1.
+	Pollers int
+
+	// Time allowed for in-flight handlers to finish once the consumer
+	// shuts down. Zero waits for handlers indefinitely.
+	DrainTimeout time.Duration
+
+	// Release (make immediately visible) messages that were received
+	// but not yet passed to a handler when the consumer shuts down,
+	// rather than leaving them hidden until their visibility timeout
+	// expires.
+	ReleaseUndelivered bool
+
+	// Called when a receive fails with a transient error (see
+	// IsTransient). The consumer keeps polling through transient
+	// failures, backing off between attempts, and only stops for
+	// other errors.
+	OnTransientError func(error)
+
+	// Skip messages whose MessageId is being or was already handled
+	// through the cache. Consume can't tell whether a handler
+	// succeeded, so skipped duplicates are left on the queue to
+	// become visible again; Handle deletes duplicates of messages
+	// whose handler succeeded. Deduplication is disabled if nil.
+	Dedup *DedupCache
+}
+
+// Receive messages from the queue and pass each one to `handler` until
+// `ctx` is cancelled or a receive fails with an error that isn't
+// transient.
+//
+// On shutdown the consumer stops polling, optionally releases messages
+// that were not yet handled, and waits up to the drain timeout for
+// in-flight handlers to finish. Returns nil after a clean shutdown, the
+// receive error if polling failed, or ErrDrainTimeout if handlers were
+// still running when the drain timeout expired.
+//
+// Handlers are responsible for deleting messages they have processed.
+// With a Dedup cache, messages are recorded as handled once their
+// handler returns.
+func (q Queue) Consume(ctx context.Context, c Context, handler func(SQSMessage), opts ConsumeOptions) error {
+
+	receive := opts.Receive
+	if receive.Mode == ReceiveWaitDefault {
+		receive.Mode = LongPoll
+	}
+	if receive.MaxMessages == 0 {
+		receive.MaxMessages = MaxReceiveMessages
+	}
+
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	buffer := opts.BufferSize
+	if buffer <= 0 {
+		buffer = receive.MaxMessages
+	}
+
+	pollers := opts.Pollers
+	if pollers <= 0 {
+		pollers = 1
+	}
+
+	pollCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// a slot is held for each message from when it is received until
+	// its handler returns, bounding the messages held by the consumer
+	slots := make(chan struct{}, concurrency+buffer)
+	work := make(chan SQSMessage, concurrency+buffer)
+
+	undelivered := func(m SQSMessage) {
+		if opts.ReleaseUndelivered {
+			q.ReleaseMessage(c, m.ReceiptHandle)
+		}
+		<-slots
+	}
+
+	var wg sync.WaitGroup
+	for ii := 0; ii < concurrency; ii++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for m := range work {
+				if pollCtx.Err() != nil {
+					undelivered(m)
+					continue
+				}
+
+				if opts.Dedup == nil {
+					handler(m)
+				} else if opts.Dedup.begin(m.MessageId) == dedupNew {
+					handler(m)
+					opts.Dedup.finish(m.MessageId, true)
+				}
+				<-slots
+			}
+		}()
+	}
+
+	var mu sync.Mutex
+	var err error
+	var pollWg sync.WaitGroup
+	for ii := 0; ii < pollers; ii++ {
+		pollWg.Add(1)
+		go func() {
+			defer pollWg.Done()
+			if pollErr := q.poll(pollCtx, c, receive, slots, work, opts.OnTransientError); pollErr != nil {
+				mu.Lock()
+				if err == nil {
+					err = pollErr
+				}
+				mu.Unlock()
+				cancel()
+			}
+		}()
+	}
+
+	pollWg.Wait()
+	cancel()
+	close(work)
+
+	// messages still buffered were never passed to a handler
+	for m := range work {
+		undelivered(m)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	if opts.DrainTimeout > 0 {
+		timer := time.NewTimer(opts.DrainTimeout)
+		defer timer.Stop()
+
+		select {
+		case <-done:
+		case <-timer.C:
+			return ErrDrainTimeout
+		}
+	} else {
+		<-done
+	}
+
+	return err
+}
+
+// Receive messages into `work` until `ctx` is cancelled or a receive
+// fails with an error that isn't transient. A slot is taken from
+// `slots` for each message before it is received.
+func (q Queue) poll(ctx context.Context, c Context, receive ReceiveOptions, slots chan struct{}, work chan<- SQSMessage, onTransient func(error)) error {
+
+	var delay time.Duration
+	for {
+		// wait for room for one message, then take whatever other
+		// room is free, up to a full receive
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil
+		}
+
+		n := 1
+	fill:
+		for n < receive.MaxMessages {
+			select {
+			case slots <- struct{}{}:
+				n++
+			default:
+				break fill
+			}
+		}
+
+		opts := receive
+		opts.MaxMessages = n
+		messages, err := q.ReceiveSupervised(ctx, c, opts, onTransient)
+		for ii := len(messages); ii < n; ii++ {
+			<-slots
+		}
+
+		// never blocks, as each message holds a slot
+		for _, m := range messages {
+			work <- m
+		}
+
+		if ctx.Err() != nil {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		// an empty short poll doesn't mean the queue is empty, but
+		// polling again immediately would spin
+		if receive.Mode == ShortPoll {
+			if len(messages) > 0 {
+				delay = 0
+			} else if delay < emptyPollBackoffMax {
+				delay += emptyPollBackoffStep
+			}
+
+			if delay > 0 {
+				timer := time.NewTimer(delay)
+				select {
+				case <-ctx.Done():
+					timer.Stop()
+					return nil
+				case <-timer.C:
+				}
+			}
+		}
+	}
+}
+
+// How long successfully handled messages may wait to be batched with
+// others before being deleted.
+const deleteBatchInterval = time.Second
+
+// Options controlling Queue.Handle.
+type HandleOptions struct {
+	ConsumeOptions
+
+	// Release messages whose handler fails so they can be received
+	// again immediately. Otherwise they become visible again once
+	// their visibility timeout expires.
+	ReleaseOnError bool
+
+	// Called with the receipt handle of each message that could not
+	// be deleted after its handler succeeded. Such messages become
+	// visible again and are handled a second time. If nil, failures
+	// are logged through the Context's Logf hook, if set. May be
+	// called concurrently.
+	OnDeleteError func(receiptHandle string, err error)
+}
+
+// Report a failed delete through the delete error hook or the
+// context's logger.
+func (opts HandleOptions) deleteFailed(c Context, receiptHandle string, err error) {
+	if opts.OnDeleteError != nil {
+		opts.OnDeleteError(receiptHandle, err)
+	} else if c.Logf != nil {
+		c.Logf("goaws: failed to delete message %s: %v", receiptHandle, err)
+	}
+}
+
+// Receive messages from the queue and pass each one to `handler`, with
+// at-least-once semantics: messages are deleted once their handler
+// returns nil, and are left on the queue (or released) when it returns
+// an error. Deletes are batched for throughput.
+//
+// Runs until `ctx` is cancelled or a receive fails, shutting down as
+// described for Consume. Pending deletes are flushed before returning.
+//
+// With a Dedup cache, messages are only recorded as handled once their
+// handler succeeds, so failed messages are retried when redelivered.
+func (q Queue) Handle(ctx context.Context, c Context, handler func(SQSMessage) error, opts HandleOptions) error {
+
+	dedup := opts.Dedup
+	consumeOpts := opts.ConsumeOptions
+	consumeOpts.Dedup = nil
+
+	deletes := make(chan string)
+	deleterDone := make(chan struct{})
+	go func() {
+		defer close(deleterDone)
+		q.batchDeletes(c, deletes, func(receiptHandle string, err error) {
+			opts.deleteFailed(c, receiptHandle, err)
+		})
+	}()
+
+	// handlers may still be running after a drain timeout, so once the
+	// batcher is shut down stragglers delete their messages directly
+	var mu sync.RWMutex
+	closed := false
+	deleteMessage := func(receiptHandle string) {
+		mu.RLock()
+		if !closed {
+			deletes <- receiptHandle
+			mu.RUnlock()
+			return
+		}
+		mu.RUnlock()
+
+		if err := q.DeleteMessage(c, receiptHandle); err != nil {
+			opts.deleteFailed(c, receiptHandle, err)
+		}
+	}
+
+	err := q.Consume(ctx, c, func(m SQSMessage) {
+		state := dedupNew
+		if dedup != nil {
+			state = dedup.begin(m.MessageId)
+		}
+
+		switch state {
+		case dedupHandled:
+			deleteMessage(m.ReceiptHandle)
+
+		case dedupInFlight:
+			// left to become visible again, in case the
+			// handler of the earlier delivery fails
+
+		default:
+			err := handler(m)
+			if dedup != nil {
+				dedup.finish(m.MessageId, err == nil)
+			}
+
+			if err == nil {
+				deleteMessage(m.ReceiptHandle)
+			} else if opts.ReleaseOnError {
+				q.ReleaseMessage(c, m.ReceiptHandle)
+			}
+		}
+	}, consumeOpts)
+
+	mu.Lock()
+	closed = true
+	close(deletes)
+	mu.Unlock()
+
+	<-deleterDone
+	return err
+}
+
+// Delete messages whose receipt handles are sent on `handles` in
+// batches, until the channel is closed. `onError` is called, possibly
+// concurrently, for each message that could not be deleted.
+func (q Queue) batchDeletes(c Context, handles <-chan string, onError func(receiptHandle string, err error)) {
+
+	ticker := time.NewTicker(deleteBatchInterval)
+	defer ticker.Stop()
+
+	// batches are deleted in the background, so handlers queueing
+	// deletes never wait on a DeleteMessageBatch request
+	inFlight := make(chan struct{}, maxConcurrentDeleteBatches)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	var pending []string
+	flush := func() {
+		if len(pending) == 0 {
+			return
+		}
+
+		batch := pending
+		pending = nil
+
+		inFlight <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-inFlight }()
+
+			failed, err := q.DeleteMessageBatch(c, batch)
+			if err != nil {
+				for _, handle := range batch {
+					onError(handle, err)
+				}
+			}
+			for handle, err := range failed {
+				onError(handle, err)
+			}
+		}()
+	}
+
+	for {
+		select {
+		case handle, ok := <-handles:
+			if !ok {
+				flush()
+				return
+			}
+
+			pending = append(pending, handle)
+			if len(pending) == maxBatchEntries {
+				flush()
+			}
+
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
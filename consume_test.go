@@ -0,0 +1,370 @@
+// Copyright 2012 Matthew Endsley
+// All rights reserved
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted providing that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+// STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+// IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package goaws
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConsumeShutdown(t *testing.T) {
+
+	tests := []struct {
+		name               string
+		drainTimeout       time.Duration
+		releaseUndelivered bool
+
+		// How long the in-flight handler keeps running once shutdown
+		// starts
+		handlerTime time.Duration
+
+		err      error
+		released int
+	}{
+		{"waits for handlers", 0, false, 50 * time.Millisecond, nil, 0},
+		{"drain timeout", 20 * time.Millisecond, false, time.Second, ErrDrainTimeout, 0},
+		{"releases undelivered", 0, true, 0, nil, 2},
+	}
+
+	for _, tt := range tests {
+		var mu sync.Mutex
+		receives := 0
+		var released []string
+		q := newTestQueue(t, func(action string, params url.Values) string {
+			mu.Lock()
+			defer mu.Unlock()
+
+			switch action {
+			case "ReceiveMessage":
+				receives++
+				if receives == 1 {
+					return testReceiveResponse("1", "2", "3")
+				}
+				return testReceiveResponse()
+
+			case "ChangeMessageVisibility":
+				if params.Get("VisibilityTimeout") != "0" {
+					t.Errorf("%s: VisibilityTimeout = %s, want 0", tt.name, params.Get("VisibilityTimeout"))
+				}
+				released = append(released, params.Get("ReceiptHandle"))
+				return `<ChangeMessageVisibilityResponse/>`
+			}
+
+			t.Errorf("%s: unexpected action %s", tt.name, action)
+			return ""
+		})
+
+		// the only handler is busy with the first message when the
+		// consumer shuts down, leaving the others undelivered
+		ctx, cancel := context.WithCancel(context.Background())
+		handlerTime := tt.handlerTime
+		started := make(chan struct{})
+		handled := make(chan string, 3)
+		done := make(chan error, 1)
+		go func() {
+			done <- q.Consume(ctx, NewContext("id", "key"), func(m SQSMessage) {
+				if m.MessageId == "1" {
+					close(started)
+					<-ctx.Done()
+					time.Sleep(handlerTime)
+				}
+				handled <- m.MessageId
+			}, ConsumeOptions{
+				Receive:            ReceiveOptions{Mode: ShortPoll},
+				DrainTimeout:       tt.drainTimeout,
+				ReleaseUndelivered: tt.releaseUndelivered,
+			})
+		}()
+
+		select {
+		case <-started:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s: no message handled", tt.name)
+		}
+
+		cancel()
+		var err error
+		select {
+		case err = <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s: consumer didn't shut down", tt.name)
+		}
+
+		if err != tt.err {
+			t.Errorf("%s: error = %v, want %v", tt.name, err, tt.err)
+		}
+
+		// the in-flight handler finished unless the drain timed out
+		wantHandled := 1
+		if tt.err == ErrDrainTimeout {
+			wantHandled = 0
+		}
+		if len(handled) != wantHandled {
+			t.Errorf("%s: %d messages handled at shutdown, want %d", tt.name, len(handled), wantHandled)
+		}
+
+		mu.Lock()
+		sort.Strings(released)
+		if len(released) != tt.released || (tt.released > 0 && (released[0] != "2" || released[1] != "3")) {
+			t.Errorf("%s: released %v, want %d undelivered messages", tt.name, released, tt.released)
+		}
+		mu.Unlock()
+	}
+}
+
+func TestBatchDeletesReportsFailures(t *testing.T) {
+
+	const partial = `<DeleteMessageBatchResponse><DeleteMessageBatchResult>
+<BatchResultErrorEntry><Id>1</Id><Code>ReceiptHandleIsInvalid</Code><SenderFault>true</SenderFault></BatchResultErrorEntry>
+</DeleteMessageBatchResult></DeleteMessageBatchResponse>`
+
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		failed []string
+	}{
+		{"all deleted", http.StatusOK, `<DeleteMessageBatchResponse/>`, nil},
+		{"entry failed", http.StatusOK, partial, []string{"b"}},
+		{"request failed", http.StatusForbidden, `<ErrorResponse><Error><Code>AccessDenied</Code></Error></ErrorResponse>`, []string{"a", "b", "c"}},
+	}
+
+	for _, tt := range tests {
+		q, _ := newTestSQSServer(t, tt.status, tt.body)
+
+		handles := make(chan string, 3)
+		handles <- "a"
+		handles <- "b"
+		handles <- "c"
+		close(handles)
+
+		var mu sync.Mutex
+		var failed []string
+		q.batchDeletes(NewContext("id", "key"), handles, func(receiptHandle string, err error) {
+			if err == nil {
+				t.Errorf("%s: %s reported with a nil error", tt.name, receiptHandle)
+			}
+			mu.Lock()
+			failed = append(failed, receiptHandle)
+			mu.Unlock()
+		})
+
+		sort.Strings(failed)
+		if len(failed) != len(tt.failed) {
+			t.Errorf("%s: failed = %v, want %v", tt.name, failed, tt.failed)
+			continue
+		}
+		for ii := range failed {
+			if failed[ii] != tt.failed[ii] {
+				t.Errorf("%s: failed = %v, want %v", tt.name, failed, tt.failed)
+				break
+			}
+		}
+	}
+}
+
+func TestHandleDoesNotWaitForDeletes(t *testing.T) {
+
+	// the queue holds two batches of messages, and deletes block
+	// until released
+	const count = 2 * MaxReceiveMessages
+	release := make(chan struct{})
+	var mu sync.Mutex
+	received := 0
+	deleted := make(map[string]bool)
+	q := newTestQueue(t, func(action string, params url.Values) string {
+		switch action {
+		case "ReceiveMessage":
+			mu.Lock()
+			defer mu.Unlock()
+
+			max, _ := strconv.Atoi(params.Get("MaxNumberOfMessages"))
+			var ids []string
+			for ; received < count && len(ids) < max; received++ {
+				ids = append(ids, strconv.Itoa(received))
+			}
+			return testReceiveResponse(ids...)
+
+		case "DeleteMessageBatch":
+			<-release
+
+			mu.Lock()
+			defer mu.Unlock()
+			for ii := 1; params.Get("DeleteMessageBatchRequestEntry."+strconv.Itoa(ii)+".Id") != ""; ii++ {
+				deleted[params.Get("DeleteMessageBatchRequestEntry."+strconv.Itoa(ii)+".ReceiptHandle")] = true
+			}
+			return `<DeleteMessageBatchResponse/>`
+		}
+
+		t.Errorf("unexpected action %s", action)
+		return ""
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	handled := make(chan string, count)
+	done := make(chan error)
+	go func() {
+		done <- q.Handle(ctx, NewContext("id", "key"), func(m SQSMessage) error {
+			handled <- m.MessageId
+			return nil
+		}, HandleOptions{ConsumeOptions: ConsumeOptions{Receive: ReceiveOptions{Mode: ShortPoll}}})
+	}()
+
+	// every message is handled while deletes are blocked
+	timeout := time.After(5 * time.Second)
+	for ii := 0; ii < count; ii++ {
+		select {
+		case <-handled:
+		case <-timeout:
+			close(release)
+			cancel()
+			t.Fatalf("handled %d messages while deletes were blocked", ii)
+		}
+	}
+
+	close(release)
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(deleted) != count {
+		t.Errorf("deleted %d messages, want %d", len(deleted), count)
+	}
+}
+
+func TestHandleDedup(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		concurrency int
+
+		// Receipt handles of the deliveries of a single message, by
+		// receive
+		receives [][]string
+
+		deleted int
+	}{
+		{"duplicate of a handled message", 1, [][]string{{"first"}, {"second"}}, 2},
+		{"duplicate while in flight", 2, [][]string{{"first", "second"}}, 1},
+	}
+
+	for _, tt := range tests {
+		var mu sync.Mutex
+		receives := 0
+		var deleted []string
+		q := newTestQueue(t, func(action string, params url.Values) string {
+			mu.Lock()
+			defer mu.Unlock()
+
+			switch action {
+			case "ReceiveMessage":
+				var b strings.Builder
+				b.WriteString(`<ReceiveMessageResponse><ReceiveMessageResult>`)
+				if receives < len(tt.receives) {
+					for _, handle := range tt.receives[receives] {
+						b.WriteString(`<Message><MessageId>message-id</MessageId><ReceiptHandle>` + handle + `</ReceiptHandle>`)
+						b.WriteString(`<MD5OfBody>` + md5Hex("body") + `</MD5OfBody><Body>body</Body></Message>`)
+					}
+				}
+				b.WriteString(`</ReceiveMessageResult></ReceiveMessageResponse>`)
+				receives++
+				return b.String()
+
+			case "DeleteMessageBatch":
+				for ii := 1; params.Get("DeleteMessageBatchRequestEntry."+strconv.Itoa(ii)+".Id") != ""; ii++ {
+					deleted = append(deleted, params.Get("DeleteMessageBatchRequestEntry."+strconv.Itoa(ii)+".ReceiptHandle"))
+				}
+				return `<DeleteMessageBatchResponse/>`
+			}
+
+			t.Errorf("%s: unexpected action %s", tt.name, action)
+			return ""
+		})
+
+		// the handler runs until the duplicate delivery was skipped
+		dedup := NewDedupCache(0, 0)
+		release := make(chan struct{})
+		handled := make(chan string, 2)
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error, 1)
+		go func() {
+			done <- q.Handle(ctx, NewContext("id", "key"), func(m SQSMessage) error {
+				<-release
+				handled <- m.ReceiptHandle
+				return nil
+			}, HandleOptions{ConsumeOptions: ConsumeOptions{
+				Receive:     ReceiveOptions{Mode: ShortPoll},
+				Concurrency: tt.concurrency,
+				Dedup:       dedup,
+			}})
+		}()
+
+		if tt.concurrency == 1 {
+			close(release)
+		}
+		for deadline := time.Now().Add(5 * time.Second); dedup.Skipped() == 0; time.Sleep(time.Millisecond) {
+			if time.Now().After(deadline) {
+				cancel()
+				t.Fatalf("%s: duplicate not skipped", tt.name)
+			}
+		}
+		if tt.concurrency > 1 {
+			close(release)
+		}
+
+		// wait for the handler, so the consumer isn't shut down with
+		// the first delivery unhandled
+		var handle string
+		select {
+		case handle = <-handled:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s: message not handled", tt.name)
+		}
+
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+		}
+		if len(handled) != 0 {
+			t.Errorf("%s: duplicate passed to the handler", tt.name)
+		}
+
+		mu.Lock()
+		if len(deleted) != tt.deleted || deleted[0] != handle && tt.deleted == 1 {
+			t.Errorf("%s: deleted %v, want %d deliveries including %s", tt.name, deleted, tt.deleted, handle)
+		}
+		mu.Unlock()
+	}
+}
@@ -26,9 +26,15 @@ package goaws
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
 	"crypto/hmac"
+	"crypto/sha1"
 	"crypto/sha256"
 	"encoding/base64"
+	"errors"
+	"hash"
+	"io"
 	"net/http"
 	"net/url"
 	"sort"
@@ -39,10 +45,149 @@ import (
 // A context object holds the credentials needed
 // to sign/verify AWS requests.
 type Context struct {
-	keyId string
-	key   string
+	keyId    string
+	key      string
+	token    string
+	provider Credentials
+	ctx      context.Context
+	endpoint string
+
+	// Overall timeout for a request, covering connection, headers
+	// and reading the response body. Zero uses DefaultRequestTimeout
+	// and a negative value disables timeouts.
+	//
+	// Long-polling SQS receives may legitimately be held open by the
+	// server for their wait time. For those requests the effective
+	// timeout is the larger of the request timeout and the wait time
+	// plus a small buffer, so a short timeout never cuts off a long
+	// poll. All other requests use the request timeout as is.
+	RequestTimeout time.Duration
+
+	// Policy for retrying failed requests. Requests are not retried
+	// if nil.
+	Retry *RetryPolicy
+
+	// Called after every attempt at sending a request, if set.
+	OnAttempt func(AttemptMetrics)
+
+	// Transport used to send requests. http.DefaultTransport if nil.
+	// See RoundTripRecorder for capturing requests and responses.
+	Transport http.RoundTripper
+
+	// Send "Accept-Encoding: gzip" with every request. Go's transport
+	// already requests gzip when a request has no Accept-Encoding
+	// header, so this is only needed with transports that don't.
+	// Compressed responses are decompressed either way. The header
+	// isn't signed and doesn't affect request signatures.
+	AcceptGzip bool
+
+	// Maximum size in bytes of a response body. Reading beyond it
+	// fails with ErrResponseTooLarge. Zero uses
+	// DefaultMaxResponseSize.
+	MaxResponseSize int64
+
+	// Signature method used for SignatureVersion 2 signing. Defaults
+	// to HmacSHA256.
+	SignatureMethod SignatureMethod
+
+	// Send requests over plain HTTP rather than HTTPS, e.g. to a local
+	// SQS/SNS mock. Requests are signed for the host they are sent to.
+	// Traffic, including signed requests and message contents, is
+	// unencrypted: never enable this against real AWS endpoints.
+	// Purchase URLs created with Store.CreatePurchaseURL are
+	// unaffected.
+	AllowInsecureHTTP bool
+
+	// Audit hook, if set. Called with a record of every request signed
+	// with SignatureVersion 2.
+	OnSigned func(AuditRecord)
+
+	// Debug logging hook, if set. Receives the string to sign for
+	// every request signed with SignatureVersion 2. Secret keys and
+	// session tokens are never logged.
+	Logf func(format string, v ...interface{})
+}
+
+// HMAC algorithm used to compute SignatureVersion 2 signatures.
+type SignatureMethod int
+
+const (
+	HmacSHA256 SignatureMethod = iota
+
+	// Only needed for legacy endpoints and mock servers that don't
+	// accept HmacSHA256.
+	HmacSHA1
+)
+
+// Get the name of the signature method sent with signed requests.
+func (m SignatureMethod) String() string {
+	if m == HmacSHA1 {
+		return "HmacSHA1"
+	}
+
+	return "HmacSHA256"
+}
+
+// Get the hash function of the signature method.
+func (m SignatureMethod) hash() func() hash.Hash {
+	if m == HmacSHA1 {
+		return sha1.New
+	}
+
+	return sha256.New
 }
 
+// Maximum response body size when a Context doesn't specify one. Well
+// above the size of any legitimate AWS response.
+const DefaultMaxResponseSize = 8 << 20
+
+// Returned when reading a response body larger than the maximum size.
+var ErrResponseTooLarge = errors.New("Response body too large")
+
+// A response body that fails once more than a limited number of bytes
+// have been read.
+type limitedBody struct {
+	io.ReadCloser
+	remaining int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.remaining <= 0 {
+		// probe for data past the limit
+		var probe [1]byte
+		n, err := b.ReadCloser.Read(probe[:])
+		if n > 0 {
+			return 0, ErrResponseTooLarge
+		}
+		return 0, err
+	}
+
+	if int64(len(p)) > b.remaining {
+		p = p[:b.remaining]
+	}
+
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= int64(n)
+	return n, err
+}
+
+// A gzip compressed response body.
+type gzipBody struct {
+	*gzip.Reader
+	body io.ReadCloser
+}
+
+func (b gzipBody) Close() error {
+	b.Reader.Close()
+	return b.body.Close()
+}
+
+// Timeout for requests when a Context doesn't specify one.
+const DefaultRequestTimeout = 10 * time.Second
+
+// Extra time allowed beyond the server-side wait of a long poll.
+const longPollTimeoutBuffer = 5 * time.Second
+
 // Create a new context with a given AWS Access Key ID and
 // Access Key.
 func NewContext(accessKeyId, accessKey string) Context {
@@ -52,6 +197,176 @@ func NewContext(accessKeyId, accessKey string) Context {
 	}
 }
 
+// Create a copy of the context that signs requests with different
+// credentials. `token` is the session token for temporary credentials
+// (e.g. from an assumed role) and may be empty.
+//
+// Contexts are values and are never modified after creation, so the
+// original context and any copies may be used concurrently; all other
+// settings (timeouts, retry policy, hooks) are shared with the copy.
+func (c Context) WithCredentials(accessKeyId, accessKey, token string) Context {
+	c.keyId = accessKeyId
+	c.key = accessKey
+	c.token = token
+	c.provider = nil
+	return c
+}
+
+// Create a copy of the context that signs requests with credentials
+// from `provider`, e.g. InstanceProfileCredentials. The provider is
+// asked for the current credentials each time a request is signed.
+func (c Context) WithCredentialsProvider(provider Credentials) Context {
+	c.keyId = ""
+	c.key = ""
+	c.token = ""
+	c.provider = provider
+	return c
+}
+
+// Get a copy of the context holding the current credentials from its
+// provider, if it has one.
+func (c Context) resolveCredentials() (Context, error) {
+	if c.provider == nil {
+		return c, nil
+	}
+
+	cred, err := c.provider.Get()
+	if err != nil {
+		return c, errors.New("Failed to get credentials: " + err.Error())
+	}
+
+	return c.WithCredentials(cred.AccessKeyId, cred.SecretAccessKey, cred.SessionToken), nil
+}
+
+// Create a copy of the context whose requests are bound to `ctx`:
+// requests made with the copy are abandoned when `ctx` is cancelled or
+// its deadline expires. This applies to every operation, including
+// SimplePay calls such as Store.VerifyPaymentParams made while handling
+// a request.
+func (c Context) WithContext(ctx context.Context) Context {
+	c.ctx = ctx
+	return c
+}
+
+// Create a copy of the context that sends requests to `endpoint` (a
+// scheme and host, e.g. "https://canary.example.com:8443") in place of
+// the host they were built for, such as to canary a new endpoint with
+// a fraction of traffic. The request path is kept, and
+// SignatureVersion 4 requests still derive their signing region and
+// service from the original host.
+//
+// An override set this way takes precedence over an endpoint
+// configured on a Queue or Topic (e.g. with UseLocal), which in turn
+// takes precedence over the default AWS endpoint. Pass an empty
+// string to remove the override.
+func (c Context) WithEndpoint(endpoint string) Context {
+	c.endpoint = endpoint
+	return c
+}
+
+// Does the context change the URLs of the requests it signs?
+func (c Context) rewritesURLs() bool {
+	return c.endpoint != "" || c.AllowInsecureHTTP
+}
+
+// Point a request URL at the context's endpoint override, if it has
+// one, and downgrade it to plain HTTP if allowed.
+func (c Context) rewriteURL(u *url.URL) error {
+	if c.endpoint != "" {
+		override, err := url.Parse(c.endpoint)
+		if err != nil || override.Scheme == "" || override.Host == "" || (override.Path != "" && override.Path != "/") {
+			return errors.New("Invalid endpoint override: " + c.endpoint)
+		}
+
+		u.Scheme = override.Scheme
+		u.Host = override.Host
+	}
+
+	if c.AllowInsecureHTTP && u.Scheme == "https" {
+		u.Scheme = "http"
+	}
+
+	return nil
+}
+
+// Get the context.Context requests are bound to.
+func (c Context) context() context.Context {
+	if c.ctx != nil {
+		return c.ctx
+	}
+
+	return context.Background()
+}
+
+// Send an HTTP request, bounded by the context's request timeout. `wait`
+// is how long the server may hold the request open (zero for requests
+// that are not long polls).
+func (c Context) do(r *http.Request, wait time.Duration) (*http.Response, error) {
+	if c.ctx != nil && r.Context() == context.Background() {
+		r = r.WithContext(c.ctx)
+	}
+
+	if c.AcceptGzip && r.Header.Get("Accept-Encoding") == "" {
+		r = r.Clone(r.Context())
+		r.Header.Set("Accept-Encoding", "gzip")
+	}
+
+	timeout := c.RequestTimeout
+	if timeout == 0 {
+		timeout = DefaultRequestTimeout
+	}
+
+	client := &http.Client{Transport: c.Transport}
+	if timeout > 0 {
+		if wait > 0 && wait+longPollTimeoutBuffer > timeout {
+			timeout = wait + longPollTimeoutBuffer
+		}
+
+		client.Timeout = timeout
+	}
+
+	policy := c.Retry
+	if policy == nil {
+		policy = &noRetryPolicy
+	}
+
+	resp, err := c.retry(client, r, policy)
+	if err != nil {
+		return nil, err
+	}
+
+	// Go's transport transparently requests and decompresses gzip
+	// responses, but not if the request set Accept-Encoding itself
+	if !resp.Uncompressed && strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
+		gz, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			closeBody(resp)
+			return nil, errors.New("Malformed gzip response: " + err.Error())
+		}
+
+		resp.Body = gzipBody{Reader: gz, body: resp.Body}
+		resp.Header.Del("Content-Encoding")
+		resp.Header.Del("Content-Length")
+		resp.ContentLength = -1
+		resp.Uncompressed = true
+	}
+
+	limit := c.MaxResponseSize
+	if limit <= 0 {
+		limit = DefaultMaxResponseSize
+	}
+
+	resp.Body = &limitedBody{ReadCloser: resp.Body, remaining: limit}
+	return resp, nil
+}
+
+// Drain and close a response body so the underlying connection can be
+// reused.
+func closeBody(resp *http.Response) {
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+}
+
 type signingContext int
 
 const (
@@ -59,27 +374,32 @@ const (
 	purchaseSigningContext
 )
 
-func (sc signingContext) getValues(c Context, r *http.Request) url.Values {
-	params := r.URL.Query()
+// Returned when signing with an unsupported signing context.
+var ErrUnknownSigningContext = errors.New("Unknown signing context")
+
+func (sc signingContext) getValues(c Context, params url.Values) (url.Values, error) {
 	switch sc {
 	case defaultHTTPSigningContext:
 		params.Set("Timestamp", time.Now().UTC().Format(time.RFC3339))
 		params.Set("AWSAccessKeyId", c.keyId)
 		params.Set("SignatureVersion", "2")
-		params.Set("SignatureMethod", "HmacSHA256")
-		return params
+		params.Set("SignatureMethod", c.SignatureMethod.String())
+		if c.token != "" {
+			params.Set("SecurityToken", c.token)
+		}
+		return params, nil
 
 	case purchaseSigningContext:
 		params.Set("accessKey", c.keyId)
 		params.Set("signatureVersion", "2")
-		params.Set("signatureMethod", "HmacSHA256")
-		return params
+		params.Set("signatureMethod", c.SignatureMethod.String())
+		return params, nil
 	}
 
-	panic("Unknown signing context")
+	return nil, ErrUnknownSigningContext
 }
 
-func (sc signingContext) addSignature(v url.Values, signature string) {
+func (sc signingContext) addSignature(v url.Values, signature string) error {
 	switch sc {
 	case defaultHTTPSigningContext:
 		v.Set("Signature", signature)
@@ -88,39 +408,275 @@ func (sc signingContext) addSignature(v url.Values, signature string) {
 		v.Set("signature", signature)
 
 	default:
-		panic("Unknown signing context")
+		return ErrUnknownSigningContext
 	}
+
+	return nil
+}
+
+// Remove a signature added by addSignature.
+func (sc signingContext) removeSignature(v url.Values) error {
+	switch sc {
+	case defaultHTTPSigningContext:
+		v.Del("Signature")
+
+	case purchaseSigningContext:
+		v.Del("signature")
+
+	default:
+		return ErrUnknownSigningContext
+	}
+
+	return nil
+}
+
+// Signs an HTTP request using SignatureVersion 2 and the context's
+// signature method.
+// Query parameters already present on the request are kept and
+// included in the signature. Signing a previously signed request
+// replaces its signature.
+func (c Context) SignRequest(r *http.Request) error {
+	return c.sign(defaultHTTPSigningContext, r)
+}
+
+func (c Context) sign(sc signingContext, r *http.Request) error {
+
+	// Parse the query strictly; url.URL.Query silently drops malformed
+	// parameters, which would then be missing from the signed request
+	params, err := url.ParseQuery(r.URL.RawQuery)
+	if err != nil {
+		return errors.New("Malformed request query: " + err.Error())
+	}
+
+	if err := sc.removeSignature(params); err != nil {
+		return err
+	}
+
+	if sc == defaultHTTPSigningContext && c.rewritesURLs() {
+		if err := c.rewriteURL(r.URL); err != nil {
+			return err
+		}
+		r.Host = r.URL.Host
+	}
+
+	if err := c.signParams(sc, r.Method, canonicalHost(r.URL), r.URL.Path, params); err != nil {
+		return err
+	}
+
+	r.URL.RawQuery = params.Encode()
+	return nil
 }
 
-// Signs an HTTP request using SignatureVersion 2 and HmacSHA256.
-func (c Context) SignRequest(r *http.Request) {
-	c.sign(defaultHTTPSigningContext, r)
+// Create a POST request carrying `params` as a form encoded body,
+// signed using SignatureVersion 2. The request's GetBody is set, so
+// the full body is resent if the request needs to be retried.
+func (c Context) newPostRequest(endpoint string, params url.Values) (*http.Request, error) {
+
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, errors.New("Failed to create request: " + err.Error())
+	}
+
+	if err := c.rewriteURL(u); err != nil {
+		return nil, err
+	}
+
+	if err := c.signParams(defaultHTTPSigningContext, "POST", canonicalHost(u), u.Path, params); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", u.String(), strings.NewReader(params.Encode()))
+	if err != nil {
+		return nil, errors.New("Failed to create request: " + err.Error())
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return req, nil
 }
 
-func (c Context) sign(sc signingContext, r *http.Request) {
-	params := sc.getValues(c, r)
+// Add the signing parameters and signature for a request to `params`.
+func (c Context) signParams(sc signingContext, method, host, path string, params url.Values) error {
+	c, err := c.resolveCredentials()
+	if err != nil {
+		return err
+	}
 
-	values := strings.Split(params.Encode(), "&")
-	sort.Strings(values)
-	queryString := strings.Join(values, "&")
-	queryString = strings.Replace(queryString, "+", "%20", -1)
-	queryString = strings.Replace(queryString, "(", "%28", -1)
-	queryString = strings.Replace(queryString, ")", "%29", -1)
+	params, err = sc.getValues(c, params)
+	if err != nil {
+		return err
+	}
+
+	signString := stringToSign(method, host, path, params)
+	if c.Logf != nil {
+		c.Logf("goaws: string to sign:\n%s", loggedStringToSign(method, host, path, params))
+	}
+	if c.OnSigned != nil {
+		c.OnSigned(newAuditRecord(method, host, path, params))
+	}
+
+	sign := hmac.New(c.SignatureMethod.hash(), []byte(c.key))
+	sign.Write([]byte(signString))
+
+	signature := base64.StdEncoding.EncodeToString(sign.Sum(nil))
+	return sc.addSignature(params, signature)
+}
+
+// Get the string to sign for debug logging, without the session token.
+func loggedStringToSign(method, host, path string, params url.Values) string {
+	if _, ok := params["SecurityToken"]; !ok {
+		return stringToSign(method, host, path, params)
+	}
+
+	logged := make(url.Values, len(params))
+	for key, values := range params {
+		logged[key] = values
+	}
+	logged.Del("SecurityToken")
+	return stringToSign(method, host, path, logged)
+}
+
+// Get the SignatureVersion 2 string to sign for a request, useful when
+// debugging SignatureDoesNotMatch errors. If the request has already
+// been signed by SignRequest, this is the exact string that was signed.
+// Otherwise it is the string SignRequest would sign now. The parameters
+// of a POST request, as sent by Send and Publish, are read from its
+// form-encoded body. The request is not modified.
+func (c Context) StringToSign(r *http.Request) (string, error) {
+	c, err := c.resolveCredentials()
+	if err != nil {
+		return "", err
+	}
+
+	params := r.URL.Query()
+	if r.Method == "POST" {
+		form, err := readForm(r)
+		if err != nil {
+			return "", err
+		}
+		for key, values := range form {
+			params[key] = append(params[key], values...)
+		}
+	}
+	if params.Get("Signature") != "" {
+		params.Del("Signature")
+	} else {
+		if params, err = defaultHTTPSigningContext.getValues(c, params); err != nil {
+			return "", err
+		}
+	}
+
+	return stringToSign(r.Method, canonicalHost(r.URL), r.URL.Path, params), nil
+}
+
+// Get the host of a URL as signed: the default port of the scheme
+// (443 for https, 80 for http) is omitted, as AWS does when
+// canonicalizing requests. Other ports are kept.
+func canonicalHost(u *url.URL) string {
+	port := u.Port()
+	if (port == "443" && u.Scheme == "https") || (port == "80" && u.Scheme == "http") {
+		return strings.TrimSuffix(u.Host, ":"+port)
+	}
+
+	return u.Host
+}
+
+// Read the form-encoded body of a request, leaving the body unread.
+func readForm(r *http.Request) (url.Values, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, nil
+	}
+
+	body := r.Body
+	if r.GetBody != nil {
+		var err error
+		if body, err = r.GetBody(); err != nil {
+			return nil, errors.New("Failed to read request body: " + err.Error())
+		}
+	}
+	defer body.Close()
+
+	b, err := io.ReadAll(body)
+	if err != nil {
+		return nil, errors.New("Failed to read request body: " + err.Error())
+	}
+	if r.GetBody == nil {
+		r.Body = io.NopCloser(bytes.NewReader(b))
+	}
+
+	form, err := url.ParseQuery(string(b))
+	if err != nil {
+		return nil, errors.New("Malformed request body: " + err.Error())
+	}
+
+	return form, nil
+}
+
+// Percent-encode a string following the RFC 3986 rules AWS uses when
+// signing: unreserved characters (A-Z, a-z, 0-9, '-', '_', '.' and
+// '~') are left as is, and every other byte, including each byte of a
+// multibyte UTF-8 sequence, is encoded as %XX with uppercase hex
+// digits. Spaces are encoded as %20, never '+'.
+func awsEncode(s string) string {
+
+	const hex = "0123456789ABCDEF"
+
+	var b strings.Builder
+	b.Grow(len(s))
+	for ii := 0; ii < len(s); ii++ {
+		ch := s[ii]
+		if ('A' <= ch && ch <= 'Z') || ('a' <= ch && ch <= 'z') || ('0' <= ch && ch <= '9') || ch == '-' || ch == '_' || ch == '.' || ch == '~' {
+			b.WriteByte(ch)
+		} else {
+			b.WriteByte('%')
+			b.WriteByte(hex[ch>>4])
+			b.WriteByte(hex[ch&0xF])
+		}
+	}
+
+	return b.String()
+}
+
+// Build the SignatureVersion 2 canonical query string, sorted by
+// parameter name and then by encoded value. Sorting whole "name=value"
+// strings would misorder names that are a prefix of another name, as
+// '=' sorts after characters such as '.' and '-'.
+func canonicalQuery(params url.Values) string {
+
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var query []string
+	for _, key := range keys {
+		values := make([]string, len(params[key]))
+		for ii, value := range params[key] {
+			values[ii] = awsEncode(value)
+		}
+		sort.Strings(values)
+
+		for _, value := range values {
+			query = append(query, awsEncode(key)+"="+value)
+		}
+	}
+
+	return strings.Join(query, "&")
+}
+
+// Build the SignatureVersion 2 string to sign.
+func stringToSign(method, host, path string, params url.Values) string {
+
+	queryString := canonicalQuery(params)
 
 	var signString bytes.Buffer
-	signString.WriteString(r.Method)
+	signString.WriteString(method)
 	signString.WriteRune('\n')
-	signString.WriteString(r.URL.Host)
+	signString.WriteString(host)
 	signString.WriteRune('\n')
-	signString.WriteString(r.URL.Path)
+	signString.WriteString(path)
 	signString.WriteRune('\n')
 	signString.WriteString(queryString)
 
-	sign := hmac.New(sha256.New, []byte(c.key))
-	sign.Write(signString.Bytes())
-
-	signature := base64.StdEncoding.EncodeToString(sign.Sum(nil))
-	sc.addSignature(params, signature)
-
-	r.URL.RawQuery = params.Encode()
+	return signString.String()
 }
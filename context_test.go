@@ -0,0 +1,467 @@
+// Copyright 2012 Matthew Endsley
+// All rights reserved
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted providing that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+// STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+// IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package goaws
+
+import (
+	"compress/gzip"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRetriedPostResendsBody(t *testing.T) {
+
+	message := strings.Repeat("message ", 1024)
+	tests := []struct {
+		name     string
+		response string
+		send     func(c Context, srvURL string) error
+	}{
+		{"SQS SendMessage", `<SendMessageResponse><SendMessageResult><MessageId>message-id</MessageId><MD5OfMessageBody>` + md5Hex(message) + `</MD5OfMessageBody></SendMessageResult></SendMessageResponse>`,
+			func(c Context, srvURL string) error {
+				_, err := NewQueue(srvURL+"/123456789012/queue").SendMessage(c, message)
+				return err
+			}},
+		{"SNS Publish", `<PublishResponse><PublishResult><MessageId>message-id</MessageId></PublishResult></PublishResponse>`,
+			func(c Context, srvURL string) error {
+				topic, err := NewTopic("sns.us-east-1.amazonaws.com", "arn:aws:sns:us-east-1:123456789012:topic").UseLocal(srvURL)
+				if err != nil {
+					return err
+				}
+				_, _, err = topic.Publish(c, message)
+				return err
+			}},
+	}
+
+	for _, tt := range tests {
+		var bodies []string
+		var contentTypes []string
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			if int64(len(body)) != r.ContentLength {
+				t.Errorf("%s: Content-Length = %d, body is %d bytes", tt.name, r.ContentLength, len(body))
+			}
+			bodies = append(bodies, string(body))
+			contentTypes = append(contentTypes, r.Header.Get("Content-Type"))
+
+			// fail the first attempt so the request is retried
+			if len(bodies) == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.Write([]byte(tt.response))
+		}))
+
+		c := NewContext("id", "key")
+		c.Retry = &RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond, Jitter: JitterNone}
+		err := tt.send(c, srv.URL)
+		srv.Close()
+
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+		}
+		if len(bodies) != 2 {
+			t.Fatalf("%s: sent %d requests, want 2", tt.name, len(bodies))
+		}
+		if bodies[1] != bodies[0] || !strings.Contains(bodies[0], "Signature=") {
+			t.Errorf("%s: retried body differs from the original:\n%q\n%q", tt.name, bodies[0], bodies[1])
+		}
+		for _, contentType := range contentTypes {
+			if contentType != "application/x-www-form-urlencoded" {
+				t.Errorf("%s: Content-Type = %q", tt.name, contentType)
+			}
+		}
+	}
+}
+func TestStringToSignPost(t *testing.T) {
+
+	c := NewContext("id", "key")
+	req, err := c.newPostRequest("https://sqs.us-east-1.amazonaws.com/123456789012/queue", url.Values{
+		"Action":      {"SendMessage"},
+		"MessageBody": {"a b+c"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"replayable body", "plain body"} {
+		signString, err := c.StringToSign(req)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		if !strings.HasPrefix(signString, "POST\n") || !strings.Contains(signString, "MessageBody=a%20b%2Bc") {
+			t.Errorf("%s: body parameters not signed:\n%s", name, signString)
+		}
+
+		// the body is left for the request to send
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		mac := hmac.New(c.SignatureMethod.hash(), []byte("key"))
+		mac.Write([]byte(signString))
+		if form.Get("Signature") != base64.StdEncoding.EncodeToString(mac.Sum(nil)) {
+			t.Errorf("%s: string to sign doesn't match the signature", name)
+		}
+
+		req.Body = io.NopCloser(strings.NewReader(string(body)))
+		req.GetBody = nil
+	}
+}
+
+func TestLogfOmitsSecurityToken(t *testing.T) {
+
+	var logged []string
+	c := NewContext("id", "key").WithCredentials("id", "key", "secret-token")
+	c.Logf = func(format string, v ...interface{}) {
+		logged = append(logged, fmt.Sprintf(format, v...))
+	}
+
+	req, err := http.NewRequest("GET", "https://sqs.us-east-1.amazonaws.com/?foo=bar", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SignRequest(req); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(logged) != 1 {
+		t.Fatalf("logged %d messages, want 1", len(logged))
+	}
+	if strings.Contains(logged[0], "secret-token") || strings.Contains(logged[0], "SecurityToken") {
+		t.Errorf("session token logged:\n%s", logged[0])
+	}
+	if !strings.Contains(logged[0], "foo=bar") {
+		t.Errorf("string to sign not logged:\n%s", logged[0])
+	}
+	if req.URL.Query().Get("SecurityToken") != "secret-token" {
+		t.Errorf("SecurityToken = %q, want %q", req.URL.Query().Get("SecurityToken"), "secret-token")
+	}
+	if !validTestSignature(t, c, req) {
+		t.Errorf("invalid signature")
+	}
+}
+
+// Check the SignatureVersion 2 signature of a signed request.
+func validTestSignature(t *testing.T, c Context, r *http.Request) bool {
+
+	signString, err := c.StringToSign(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mac := hmac.New(c.SignatureMethod.hash(), []byte("key"))
+	mac.Write([]byte(signString))
+	return r.URL.Query().Get("Signature") == base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestGzipResponse(t *testing.T) {
+
+	tests := []struct {
+		name       string
+		acceptGzip bool
+	}{
+		{"transport requests gzip", false},
+		{"AcceptGzip", true},
+	}
+
+	for _, tt := range tests {
+		var acceptEncoding string
+		var signatureValid bool
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			acceptEncoding = r.Header.Get("Accept-Encoding")
+
+			// verify the signature as SNS would
+			r.ParseForm()
+			params := r.PostForm
+			signature := params.Get("Signature")
+			params.Del("Signature")
+			mac := hmac.New(sha256.New, []byte("key"))
+			mac.Write([]byte(stringToSign(r.Method, r.Host, r.URL.Path, params)))
+			signatureValid = signature == base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+			w.Header().Set("Content-Encoding", "gzip")
+			gz := gzip.NewWriter(w)
+			gz.Write([]byte(`<PublishResponse><PublishResult><MessageId>message-id</MessageId></PublishResult></PublishResponse>`))
+			gz.Close()
+		}))
+
+		topic, err := NewTopic("sns.us-east-1.amazonaws.com", "arn:aws:sns:us-east-1:123456789012:topic").UseLocal(srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		c := NewContext("id", "key")
+		c.AcceptGzip = tt.acceptGzip
+		messageId, _, err := topic.Publish(c, "message")
+		srv.Close()
+
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+		} else if messageId != "message-id" {
+			t.Errorf("%s: MessageId = %q, want message-id", tt.name, messageId)
+		}
+		if acceptEncoding != "gzip" {
+			t.Errorf("%s: Accept-Encoding = %q, want gzip", tt.name, acceptEncoding)
+		}
+		if !signatureValid {
+			t.Errorf("%s: invalid signature", tt.name)
+		}
+	}
+}
+
+func TestSignRequestKeepsQuery(t *testing.T) {
+
+	tests := []struct {
+		name  string
+		query string
+		want  url.Values
+	}{
+		{"caller parameter", "foo=bar", url.Values{"foo": {"bar"}}},
+		{"repeated parameter", "foo=b&foo=a", url.Values{"foo": {"b", "a"}}},
+		{"escaped parameter", "foo=a%20b%2Bc", url.Values{"foo": {"a b+c"}}},
+		{"stale signature", "foo=bar&Signature=stale&Timestamp=2001-01-01T00%3A00%3A00Z", url.Values{"foo": {"bar"}}},
+	}
+
+	for _, tt := range tests {
+		c := NewContext("id", "key")
+		req, err := http.NewRequest("GET", "https://sqs.us-east-1.amazonaws.com/?"+tt.query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := c.SignRequest(req); err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+			continue
+		}
+
+		query := req.URL.Query()
+		for key, values := range tt.want {
+			if strings.Join(query[key], ",") != strings.Join(values, ",") {
+				t.Errorf("%s: %s = %q, want %q", tt.name, key, query[key], values)
+			}
+		}
+		if len(query["Signature"]) != 1 || len(query["Timestamp"]) != 1 || query.Get("Timestamp") == "2001-01-01T00:00:00Z" {
+			t.Errorf("%s: stale signing parameters kept: %v", tt.name, query)
+		}
+
+		signString, err := c.StringToSign(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(signString, "foo=") {
+			t.Errorf("%s: caller parameters not signed:\n%s", tt.name, signString)
+		}
+		if !validTestSignature(t, c, req) {
+			t.Errorf("%s: invalid signature", tt.name)
+		}
+	}
+}
+
+func TestSignatureMethod(t *testing.T) {
+
+	// Signatures of the purchase request below with the secret key
+	// "key", computed independently of this package
+	tests := []struct {
+		method    SignatureMethod
+		name      string
+		signature string
+	}{
+		{HmacSHA256, "HmacSHA256", "jULe5KKuVrBaBC5Bv/2GUZktDIvIzyi1ADKbbEsZBV8="},
+		{HmacSHA1, "HmacSHA1", "zZ0E2b1xmuIGLQ3lJgi1uLHIRHk="},
+	}
+
+	for _, tt := range tests {
+		c := NewContext("id", "key")
+		c.SignatureMethod = tt.method
+
+		req, err := http.NewRequest("GET", "https://authorize.payments.amazon.com/pba/paypipeline?amount=USD%201.00&description=test", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := c.sign(purchaseSigningContext, req); err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+			continue
+		}
+
+		query := req.URL.Query()
+		if got := query.Get("signatureMethod"); got != tt.name {
+			t.Errorf("%s: signatureMethod = %q", tt.name, got)
+		}
+		if got := query.Get("signature"); got != tt.signature {
+			t.Errorf("%s: signature = %q, want %q", tt.name, got, tt.signature)
+		}
+
+		// requests signed for AWS services use the same method
+		req, err = http.NewRequest("GET", "https://sqs.us-east-1.amazonaws.com/?Action=ListQueues", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := c.SignRequest(req); err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+		} else if got := req.URL.Query().Get("SignatureMethod"); got != tt.name {
+			t.Errorf("%s: SignatureMethod = %q", tt.name, got)
+		} else if !validTestSignature(t, c, req) {
+			t.Errorf("%s: invalid signature", tt.name)
+		}
+	}
+}
+
+func TestCanonicalHost(t *testing.T) {
+
+	tests := []struct {
+		rawURL string
+		want   string
+	}{
+		{"https://sqs.us-east-1.amazonaws.com/", "sqs.us-east-1.amazonaws.com"},
+		{"https://sqs.us-east-1.amazonaws.com:443/", "sqs.us-east-1.amazonaws.com"},
+		{"http://localhost:80/", "localhost"},
+		{"http://localhost:4566/", "localhost:4566"},
+		{"https://localhost:8443/", "localhost:8443"},
+		{"http://localhost:443/", "localhost:443"},
+		{"https://localhost:80/", "localhost:80"},
+		{"https://[::1]:443/", "[::1]"},
+		{"http://[::1]:9324/", "[::1]:9324"},
+	}
+
+	for _, tt := range tests {
+		u, err := url.Parse(tt.rawURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := canonicalHost(u); got != tt.want {
+			t.Errorf("%s: canonical host = %q, want %q", tt.rawURL, got, tt.want)
+		}
+	}
+}
+
+func TestSignatureOmitsDefaultPort(t *testing.T) {
+
+	// The signature for the host without a port, as in
+	// TestSignatureMethod
+	const want = "jULe5KKuVrBaBC5Bv/2GUZktDIvIzyi1ADKbbEsZBV8="
+
+	tests := []struct {
+		host  string
+		match bool
+	}{
+		{"authorize.payments.amazon.com", true},
+		{"authorize.payments.amazon.com:443", true},
+		{"authorize.payments.amazon.com:8443", false},
+	}
+
+	for _, tt := range tests {
+		req, err := http.NewRequest("GET", "https://"+tt.host+"/pba/paypipeline?amount=USD%201.00&description=test", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := NewContext("id", "key").sign(purchaseSigningContext, req); err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.host, err)
+		} else if got := req.URL.Query().Get("signature"); (got == want) != tt.match {
+			t.Errorf("%s: signature = %q, matches the portless host: %v", tt.host, got, !tt.match)
+		}
+	}
+}
+
+func TestAWSEncode(t *testing.T) {
+
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"", ""},
+		{"AZaz09-_.~", "AZaz09-_.~"},
+		{"a b", "a%20b"},
+		{"a+b", "a%2Bb"},
+		{"*", "%2A"},
+		{"/?#[]@", "%2F%3F%23%5B%5D%40"},
+		{"!$&'()*+,;=", "%21%24%26%27%28%29%2A%2B%2C%3B%3D"},
+		{"%20", "%2520"},
+		{"\x00\x1f\x7f", "%00%1F%7F"},
+		{"é", "%C3%A9"},
+		{"日本", "%E6%97%A5%E6%9C%AC"},
+		{"😀", "%F0%9F%98%80"},
+		{"\xff", "%FF"},
+	}
+
+	for _, tt := range tests {
+		if got := awsEncode(tt.in); got != tt.want {
+			t.Errorf("awsEncode(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+
+	// every ASCII character outside the unreserved set is escaped
+	const unreserved = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-_.~"
+	for ch := 0; ch < 128; ch++ {
+		want := fmt.Sprintf("%%%02X", ch)
+		if strings.IndexByte(unreserved, byte(ch)) >= 0 {
+			want = string(rune(ch))
+		}
+
+		if got := awsEncode(string(rune(ch))); got != want {
+			t.Errorf("awsEncode(%q) = %q, want %q", rune(ch), got, want)
+		}
+	}
+}
+
+func TestCanonicalQuery(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		params url.Values
+		want   string
+	}{
+		{"empty", url.Values{}, ""},
+		{"sorted by name", url.Values{"b": {"1"}, "a": {"2"}, "C": {"3"}}, "C=3&a=2&b=1"},
+		{"numbered names", url.Values{"AttributeName.2": {"b"}, "AttributeName.10": {"c"}, "AttributeName.1": {"a"}}, "AttributeName.1=a&AttributeName.10=c&AttributeName.2=b"},
+		{"name prefixes", url.Values{"Name.1": {"b"}, "Name": {"a"}, "Name-x": {"c"}}, "Name=a&Name-x=c&Name.1=b"},
+		{"repeated values", url.Values{"v": {"b", "a+b", "A", "a b"}}, "v=A&v=a%20b&v=a%2Bb&v=b"},
+		{"values sorted encoded", url.Values{"v": {"~", "é"}}, "v=%C3%A9&v=~"},
+		{"encoded names", url.Values{"a b": {"1"}, "a": {"2"}}, "a=2&a%20b=1"},
+	}
+
+	for _, tt := range tests {
+		if got := canonicalQuery(tt.params); got != tt.want {
+			t.Errorf("%s: canonical query = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+// Copyright 2012 Matthew Endsley
+// All rights reserved
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted providing that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+// STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+// IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package goaws
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A set of AWS credentials.
+type Credential struct {
+	AccessKeyId     string
+	SecretAccessKey string
+
+	// Session token for temporary credentials. May be empty.
+	SessionToken string
+
+	// Time the credentials expire. Zero if they don't expire.
+	Expires time.Time
+}
+
+// Are the credentials still valid at `t`? Credentials without an expiry
+// time are always valid.
+func (cred Credential) validAt(t time.Time) bool {
+	return cred.Expires.IsZero() || t.Before(cred.Expires)
+}
+
+// A source of AWS credentials. Get is called each time a request is
+// signed, so implementations should cache credentials, and must be
+// safe for concurrent use.
+type Credentials interface {
+	Get() (Credential, error)
+}
+
+// Endpoints of the EC2 instance metadata service (IMDSv2) and the ECS
+// container credentials service.
+const (
+	imdsEndpoint              = "http://169.254.169.254"
+	containerCredentialsHost  = "http://169.254.170.2"
+	imdsTokenTTL              = "21600"
+	instanceCredentialsWindow = 5 * time.Minute
+)
+
+// Credentials of the IAM role available to an EC2 instance or ECS
+// task. When the AWS_CONTAINER_CREDENTIALS_RELATIVE_URI environment
+// variable is set, credentials are fetched from the container
+// credentials endpoint. Otherwise they are fetched from the instance
+// metadata service using IMDSv2 session tokens.
+//
+// Credentials are cached and refreshed shortly before they expire. If
+// a refresh fails, the cached credentials are used until they expire.
+// The zero value is ready for use.
+type InstanceProfileCredentials struct {
+	// Client used to fetch credentials. A client with a short timeout
+	// is used if nil.
+	Client *http.Client
+
+	// How long before expiry credentials are refreshed. Zero uses 5
+	// minutes.
+	ExpiryWindow time.Duration
+
+	mu     sync.Mutex
+	cached Credential
+}
+
+var _ Credentials = (*InstanceProfileCredentials)(nil)
+
+// Get the current credentials, refreshing them if they are about to
+// expire.
+func (ip *InstanceProfileCredentials) Get() (Credential, error) {
+	ip.mu.Lock()
+	defer ip.mu.Unlock()
+
+	window := ip.ExpiryWindow
+	if window <= 0 {
+		window = instanceCredentialsWindow
+	}
+
+	now := time.Now()
+	if ip.cached.AccessKeyId != "" && ip.cached.validAt(now.Add(window)) {
+		return ip.cached, nil
+	}
+
+	cred, err := ip.fetch()
+	if err != nil {
+		if ip.cached.AccessKeyId != "" && ip.cached.validAt(now) {
+			return ip.cached, nil
+		}
+
+		return Credential{}, err
+	}
+
+	ip.cached = cred
+	return cred, nil
+}
+
+// Fetch fresh credentials.
+func (ip *InstanceProfileCredentials) fetch() (Credential, error) {
+	client := ip.Client
+	if client == nil {
+		client = &http.Client{Timeout: 5 * time.Second}
+	}
+
+	if uri := os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"); uri != "" {
+		req, err := http.NewRequest("GET", containerCredentialsHost+uri, nil)
+		if err != nil {
+			return Credential{}, errors.New("Failed to create request: " + err.Error())
+		}
+
+		if token := os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN"); token != "" {
+			req.Header.Set("Authorization", token)
+		}
+
+		return fetchCredential(client, req)
+	}
+
+	// IMDSv2 requires a session token for every metadata request
+	req, err := http.NewRequest("PUT", imdsEndpoint+"/latest/api/token", nil)
+	if err != nil {
+		return Credential{}, errors.New("Failed to create request: " + err.Error())
+	}
+	req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", imdsTokenTTL)
+
+	token, err := fetchMetadata(client, req)
+	if err != nil {
+		return Credential{}, err
+	}
+
+	req, err = http.NewRequest("GET", imdsEndpoint+"/latest/meta-data/iam/security-credentials/", nil)
+	if err != nil {
+		return Credential{}, errors.New("Failed to create request: " + err.Error())
+	}
+	req.Header.Set("X-aws-ec2-metadata-token", token)
+
+	roles, err := fetchMetadata(client, req)
+	if err != nil {
+		return Credential{}, err
+	}
+
+	role, _ := bufio.NewReader(strings.NewReader(roles)).ReadString('\n')
+	role = strings.TrimSpace(role)
+	if role == "" {
+		return Credential{}, errors.New("No IAM role attached to the instance")
+	}
+
+	req, err = http.NewRequest("GET", imdsEndpoint+"/latest/meta-data/iam/security-credentials/"+role, nil)
+	if err != nil {
+		return Credential{}, errors.New("Failed to create request: " + err.Error())
+	}
+	req.Header.Set("X-aws-ec2-metadata-token", token)
+
+	return fetchCredential(client, req)
+}
+
+// Fetch a metadata value.
+func fetchMetadata(client *http.Client, req *http.Request) (string, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", errors.New("Failed to do request: " + err.Error())
+	}
+
+	defer closeBody(resp)
+
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.New("Failed to fetch instance metadata: " + resp.Status)
+	}
+
+	b, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return "", errors.New("Failed to read instance metadata: " + err.Error())
+	}
+
+	return string(b), nil
+}
+
+// Fetch credentials in the JSON format shared by the instance metadata
+// and container credentials services.
+func fetchCredential(client *http.Client, req *http.Request) (Credential, error) {
+	body, err := fetchMetadata(client, req)
+	if err != nil {
+		return Credential{}, err
+	}
+
+	var response struct {
+		Code            string
+		Message         string
+		AccessKeyId     string
+		SecretAccessKey string
+		Token           string
+		Expiration      time.Time
+	}
+
+	if err := json.Unmarshal([]byte(body), &response); err != nil {
+		return Credential{}, errors.New("Malformed credentials: " + err.Error())
+	}
+
+	if response.Code != "" && response.Code != "Success" {
+		return Credential{}, errors.New("Failed to fetch credentials: (" + response.Code + ") " + response.Message)
+	}
+
+	if response.AccessKeyId == "" || response.SecretAccessKey == "" {
+		return Credential{}, errors.New("Malformed credentials: missing access key")
+	}
+
+	return Credential{
+		AccessKeyId:     response.AccessKeyId,
+		SecretAccessKey: response.SecretAccessKey,
+		SessionToken:    response.Token,
+		Expires:         response.Expiration,
+	}, nil
+}
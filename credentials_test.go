@@ -0,0 +1,72 @@
+// Copyright 2012 Matthew Endsley
+// All rights reserved
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted providing that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+// STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+// IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package goaws
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestInstanceProfileCredentialsExpiry(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		expires time.Time
+		fetched bool
+	}{
+		{"no expiry", time.Time{}, false},
+		{"valid", time.Now().Add(time.Hour), false},
+		{"within the expiry window", time.Now().Add(time.Minute), true},
+		{"expired", time.Now().Add(-time.Minute), true},
+	}
+
+	for _, tt := range tests {
+		fetched := false
+		ip := &InstanceProfileCredentials{
+			Client: &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+				fetched = true
+				return nil, errors.New("unavailable")
+			})},
+		}
+		ip.cached = Credential{AccessKeyId: "id", SecretAccessKey: "key", Expires: tt.expires}
+
+		cred, err := ip.Get()
+		if fetched != tt.fetched {
+			t.Errorf("%s: fetched = %v, want %v", tt.name, fetched, tt.fetched)
+		}
+
+		// cached credentials are used while a refresh fails, until
+		// they expire
+		if valid := tt.expires.IsZero() || time.Now().Before(tt.expires); valid {
+			if err != nil || cred.AccessKeyId != "id" {
+				t.Errorf("%s: Get() = %+v, %v, want the cached credentials", tt.name, cred, err)
+			}
+		} else if err == nil {
+			t.Errorf("%s: expired credentials returned", tt.name)
+		}
+	}
+}
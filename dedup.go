@@ -0,0 +1,113 @@
+// Copyright 2012 Matthew Endsley
+// All rights reserved
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted providing that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+// STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+// IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package goaws
+
+import (
+	"sync"
+	"time"
+)
+
+// Default settings for a DedupCache.
+const (
+	DefaultDedupCacheTTL        = defaultCacheTTL
+	DefaultDedupCacheMaxEntries = defaultCacheMaxEntries
+)
+
+// A bounded in-memory record of recently handled message ids, used by
+// Queue.Consume and Queue.Handle to skip duplicate deliveries of the
+// same message. SQS delivers messages at least once; this only catches
+// redeliveries seen by the same process within the TTL, so strict
+// deduplication still requires external storage.
+//
+// When full, the least recently used id is evicted. A DedupCache is
+// safe for concurrent use, and may be shared between consumers.
+type DedupCache struct {
+	mu      sync.Mutex
+	ids     *ttlCache[dedupState]
+	skipped int64
+}
+
+// What the cache knows about a message id.
+type dedupState int
+
+const (
+	dedupNew dedupState = iota
+	dedupInFlight
+	dedupHandled
+)
+
+// Create a dedup cache. Zero values use the default TTL and size.
+func NewDedupCache(ttl time.Duration, maxEntries int) *DedupCache {
+	return &DedupCache{
+		ids: newTTLCache[dedupState](ttl, maxEntries),
+	}
+}
+
+// Get the number of duplicate deliveries skipped using the cache.
+func (dc *DedupCache) Skipped() int64 {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+
+	return dc.skipped
+}
+
+// Start handling `id`. Returns dedupNew, and records the id as in
+// flight, if it is not a duplicate. Otherwise returns whether the
+// earlier delivery is still being handled or was handled successfully,
+// counting this delivery as a skipped duplicate.
+func (dc *DedupCache) begin(id string) dedupState {
+	if id == "" {
+		return dedupNew
+	}
+
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+
+	if state, ok := dc.ids.get(id); ok {
+		dc.skipped++
+		return state
+	}
+
+	dc.ids.put(id, dedupInFlight)
+	return dedupNew
+}
+
+// Finish handling `id`, started by begin. Successfully handled ids are
+// recorded so later deliveries are skipped; failed ids are forgotten so
+// their redelivery is handled again.
+func (dc *DedupCache) finish(id string, handled bool) {
+	if id == "" {
+		return
+	}
+
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+
+	if handled {
+		dc.ids.put(id, dedupHandled)
+	} else {
+		dc.ids.remove(id)
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright 2012 Matthew Endsley
+// All rights reserved
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted providing that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+// STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+// IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package goaws
+
+import "testing"
+
+func TestDedupCache(t *testing.T) {
+
+	type step struct {
+		finish  bool
+		handled bool
+		want    dedupState
+	}
+
+	tests := []struct {
+		name    string
+		steps   []step
+		skipped int64
+	}{
+		{"first delivery", []step{{want: dedupNew}}, 0},
+		{"redelivered while in flight", []step{{want: dedupNew}, {want: dedupInFlight}}, 1},
+		{"redelivered after failure", []step{{want: dedupNew}, {finish: true, handled: false}, {want: dedupNew}}, 0},
+		{"redelivered after success", []step{{want: dedupNew}, {finish: true, handled: true}, {want: dedupHandled}}, 1},
+	}
+
+	for _, tt := range tests {
+		dc := NewDedupCache(0, 0)
+		for ii, s := range tt.steps {
+			if s.finish {
+				dc.finish("id", s.handled)
+			} else if got := dc.begin("id"); got != s.want {
+				t.Errorf("%s: step %d: begin = %v, want %v", tt.name, ii, got, s.want)
+			}
+		}
+
+		if got := dc.Skipped(); got != tt.skipped {
+			t.Errorf("%s: skipped = %d, want %d", tt.name, got, tt.skipped)
+		}
+	}
+}
+
+func TestDedupCacheIgnoresEmptyIds(t *testing.T) {
+
+	dc := NewDedupCache(0, 0)
+	for ii := 0; ii < 2; ii++ {
+		if got := dc.begin(""); got != dedupNew {
+			t.Errorf("begin = %v, want dedupNew", got)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+// Copyright 2012 Matthew Endsley
+// All rights reserved
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted providing that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+// STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+// IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package goaws
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Function SNS uses to grow the delay between HTTP delivery retries.
+type BackoffFunction string
+
+const (
+	BackoffLinear      BackoffFunction = "linear"
+	BackoffArithmetic  BackoffFunction = "arithmetic"
+	BackoffGeometric   BackoffFunction = "geometric"
+	BackoffExponential BackoffFunction = "exponential"
+)
+
+// Retry and throttling policy for deliveries to HTTP/S subscriptions of
+// a topic. Delays are sent as whole seconds.
+type DeliveryPolicy struct {
+	// Delay of the first retry after the immediate retries, and of the
+	// last retries. MinDelay must be at least 1 second and MaxDelay
+	// between MinDelay and 1 hour.
+	MinDelay time.Duration
+	MaxDelay time.Duration
+
+	// Total number of retries, up to 100. Retries beyond the
+	// immediate, minimum and maximum delay retries are spaced by
+	// Backoff.
+	NumRetries int
+
+	// Retries made immediately, at MinDelay and at MaxDelay.
+	NumNoDelayRetries  int
+	NumMinDelayRetries int
+	NumMaxDelayRetries int
+
+	// Function used to grow the delay between retries. Defaults to
+	// BackoffLinear.
+	Backoff BackoffFunction
+
+	// Maximum deliveries per second to each subscription. Zero
+	// disables throttling.
+	MaxReceivesPerSecond int
+
+	// Prevent subscriptions from overriding the policy.
+	DisableSubscriptionOverrides bool
+}
+
+// Limits on delivery policies.
+const (
+	maxDeliveryDelay   = time.Hour
+	maxDeliveryRetries = 100
+)
+
+// Validate the policy and encode it as the JSON document SNS expects.
+func (p DeliveryPolicy) encode() (string, error) {
+
+	if p.MinDelay < time.Second || p.MaxDelay < p.MinDelay || p.MaxDelay > maxDeliveryDelay {
+		return "", fmt.Errorf("Delivery delays must satisfy 1s <= MinDelay <= MaxDelay <= 1h. Got: %v, %v", p.MinDelay, p.MaxDelay)
+	}
+
+	if p.NumRetries < 0 || p.NumRetries > maxDeliveryRetries {
+		return "", fmt.Errorf("Number of delivery retries must be between 0 and %d. Got: %d", maxDeliveryRetries, p.NumRetries)
+	}
+
+	if p.NumNoDelayRetries < 0 || p.NumMinDelayRetries < 0 || p.NumMaxDelayRetries < 0 {
+		return "", errors.New("Number of delivery retries must not be negative")
+	}
+
+	if p.NumNoDelayRetries+p.NumMinDelayRetries+p.NumMaxDelayRetries > p.NumRetries {
+		return "", fmt.Errorf("Immediate, minimum and maximum delay retries must not exceed the total of %d", p.NumRetries)
+	}
+
+	backoff := p.Backoff
+	switch backoff {
+	case "":
+		backoff = BackoffLinear
+	case BackoffLinear, BackoffArithmetic, BackoffGeometric, BackoffExponential:
+	default:
+		return "", errors.New("Unsupported backoff function: " + string(backoff))
+	}
+
+	if p.MaxReceivesPerSecond < 0 {
+		return "", fmt.Errorf("Max receives per second must not be negative. Got: %d", p.MaxReceivesPerSecond)
+	}
+
+	type retryPolicy struct {
+		MinDelayTarget     int             `json:"minDelayTarget"`
+		MaxDelayTarget     int             `json:"maxDelayTarget"`
+		NumRetries         int             `json:"numRetries"`
+		NumNoDelayRetries  int             `json:"numNoDelayRetries"`
+		NumMinDelayRetries int             `json:"numMinDelayRetries"`
+		NumMaxDelayRetries int             `json:"numMaxDelayRetries"`
+		BackoffFunction    BackoffFunction `json:"backoffFunction"`
+	}
+	type throttlePolicy struct {
+		MaxReceivesPerSecond int `json:"maxReceivesPerSecond"`
+	}
+
+	var document struct {
+		HTTP struct {
+			DefaultHealthyRetryPolicy    retryPolicy     `json:"defaultHealthyRetryPolicy"`
+			DefaultThrottlePolicy        *throttlePolicy `json:"defaultThrottlePolicy,omitempty"`
+			DisableSubscriptionOverrides bool            `json:"disableSubscriptionOverrides"`
+		} `json:"http"`
+	}
+
+	document.HTTP.DefaultHealthyRetryPolicy = retryPolicy{
+		MinDelayTarget:     int(p.MinDelay / time.Second),
+		MaxDelayTarget:     int(p.MaxDelay / time.Second),
+		NumRetries:         p.NumRetries,
+		NumNoDelayRetries:  p.NumNoDelayRetries,
+		NumMinDelayRetries: p.NumMinDelayRetries,
+		NumMaxDelayRetries: p.NumMaxDelayRetries,
+		BackoffFunction:    backoff,
+	}
+	if p.MaxReceivesPerSecond > 0 {
+		document.HTTP.DefaultThrottlePolicy = &throttlePolicy{MaxReceivesPerSecond: p.MaxReceivesPerSecond}
+	}
+	document.HTTP.DisableSubscriptionOverrides = p.DisableSubscriptionOverrides
+
+	b, err := json.Marshal(document)
+	if err != nil {
+		return "", errors.New("Failed to encode delivery policy: " + err.Error())
+	}
+
+	return string(b), nil
+}
+
+// Set the delivery policy of the topic.
+func (t Topic) SetDeliveryPolicy(c Context, p DeliveryPolicy) error {
+
+	policy, err := p.encode()
+	if err != nil {
+		return err
+	}
+
+	return t.SetAttribute(c, "DeliveryPolicy", policy)
+}
@@ -0,0 +1,120 @@
+// Copyright 2012 Matthew Endsley
+// All rights reserved
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted providing that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+// STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+// IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package goaws
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Approximate number of messages in a queue, as reported by SQS.
+type QueueDepth struct {
+	// Messages available for receiving.
+	Visible int
+
+	// Messages received but not yet deleted, or whose visibility
+	// timeout has not yet expired.
+	InFlight int
+
+	// Messages waiting out their delivery delay.
+	Delayed int
+
+	// When the counts were retrieved. Zero if they never were.
+	Updated time.Time
+}
+
+// Tracks the depth of a queue for consumers that throttle themselves
+// on it. SQS only reports message counts through queue attributes, not
+// with received messages, so the depth is cached and refreshed with a
+// GetQueueAttributes call once it is older than the refresh interval.
+// Safe for concurrent use.
+type DepthMonitor struct {
+	queue    Queue
+	interval time.Duration
+
+	mu    sync.Mutex
+	depth QueueDepth
+}
+
+// Create a monitor of the depth of `q`, refreshed at most once per
+// `interval`.
+func NewDepthMonitor(q Queue, interval time.Duration) *DepthMonitor {
+	return &DepthMonitor{
+		queue:    q,
+		interval: interval,
+	}
+}
+
+// Get the depth of the queue, refreshing it if it is older than the
+// refresh interval.
+func (m *DepthMonitor) Depth(c Context) (QueueDepth, error) {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.depth.Updated.IsZero() && time.Since(m.depth.Updated) < m.interval {
+		return m.depth, nil
+	}
+
+	attributes, err := m.queue.GetAttributes(c, "ApproximateNumberOfMessages", "ApproximateNumberOfMessagesNotVisible", "ApproximateNumberOfMessagesDelayed")
+	if err != nil {
+		return m.depth, err
+	}
+
+	depth := QueueDepth{Updated: time.Now()}
+	counts := map[string]*int{
+		"ApproximateNumberOfMessages":           &depth.Visible,
+		"ApproximateNumberOfMessagesNotVisible": &depth.InFlight,
+		"ApproximateNumberOfMessagesDelayed":    &depth.Delayed,
+	}
+	for name, n := range counts {
+		if *n, err = strconv.Atoi(attributes[name]); err != nil {
+			return m.depth, errors.New("Malformed attribute " + name + ": " + err.Error())
+		}
+	}
+
+	m.depth = depth
+	return depth, nil
+}
+
+// Receive messages from the queue along with its depth. The depth is
+// refreshed first if it is stale; if that fails, nothing is received,
+// so no messages are lost to the error.
+func (m *DepthMonitor) Receive(c Context, opts ReceiveOptions) ([]SQSMessage, QueueDepth, error) {
+
+	depth, err := m.Depth(c)
+	if err != nil {
+		return nil, depth, err
+	}
+
+	messages, err := m.queue.ReceiveMessagesWithOptions(c, opts)
+	if err != nil {
+		return nil, depth, err
+	}
+
+	return messages, depth, nil
+}
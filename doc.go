@@ -25,4 +25,8 @@
 // AWS client.
 //
 // Provides bindings for common AWS services.
+//
+// Methods returning slices or maps (received messages, attributes,
+// batch failures, ...) return nil when there are no results, never an
+// allocated empty value. Use len() to test for empty results.
 package goaws
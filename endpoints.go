@@ -0,0 +1,72 @@
+// Copyright 2012 Matthew Endsley
+// All rights reserved
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted providing that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+// STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+// IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package goaws
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+)
+
+// Get the endpoint host of a service in a region. Dualstack hosts
+// resolve to both IPv4 and IPv6 addresses.
+func serviceHost(service, region string, dualstack bool) string {
+	china := strings.HasPrefix(region, "cn-")
+	switch {
+	case dualstack && china:
+		return service + "." + region + ".api.amazonwebservices.com.cn"
+	case dualstack:
+		return service + "." + region + ".api.aws"
+	case china:
+		return service + "." + region + ".amazonaws.com.cn"
+	}
+
+	return service + "." + region + ".amazonaws.com"
+}
+
+// Get the SQS endpoint of a region, e.g. for CreateQueue. Set
+// `dualstack` to use the endpoint reachable over IPv6.
+func SQSEndpoint(region string, dualstack bool) string {
+	return "https://" + serviceHost("sqs", region, dualstack) + "/"
+}
+
+// Create a copy of the queue whose requests are sent to the dualstack
+// (IPv4 and IPv6) endpoint of its region. The queue URL's path is kept.
+func (q Queue) UseDualstack() (Queue, error) {
+
+	u, err := url.Parse(q.url)
+	if err != nil {
+		return Queue{}, errors.New("Malformed queue URL: " + err.Error())
+	}
+
+	region, service, err := hostRegionService(u.Host)
+	if err != nil || service != "sqs" {
+		return Queue{}, errors.New("Cannot determine the SQS region of queue: " + q.url)
+	}
+
+	u.Host = serviceHost("sqs", region, true)
+	q.url = u.String()
+	return q, nil
+}
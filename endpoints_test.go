@@ -0,0 +1,139 @@
+// Copyright 2012 Matthew Endsley
+// All rights reserved
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted providing that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+// STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+// IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package goaws
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestServiceHost(t *testing.T) {
+
+	tests := []struct {
+		service   string
+		region    string
+		dualstack bool
+		want      string
+	}{
+		{"sqs", "us-east-1", false, "sqs.us-east-1.amazonaws.com"},
+		{"sqs", "us-east-1", true, "sqs.us-east-1.api.aws"},
+		{"sns", "eu-west-1", true, "sns.eu-west-1.api.aws"},
+		{"sqs", "cn-north-1", false, "sqs.cn-north-1.amazonaws.com.cn"},
+		{"sqs", "cn-north-1", true, "sqs.cn-north-1.api.amazonwebservices.com.cn"},
+	}
+
+	for _, tt := range tests {
+		if got := serviceHost(tt.service, tt.region, tt.dualstack); got != tt.want {
+			t.Errorf("%s %s (dualstack: %v): host = %q, want %q", tt.service, tt.region, tt.dualstack, got, tt.want)
+		}
+	}
+
+	if got := SQSEndpoint("us-west-2", true); got != "https://sqs.us-west-2.api.aws/" {
+		t.Errorf("SQSEndpoint = %q", got)
+	}
+}
+
+func TestQueueUseDualstack(t *testing.T) {
+
+	tests := []struct {
+		queueURL string
+		want     string
+		err      bool
+	}{
+		{"https://sqs.us-east-1.amazonaws.com/123456789012/queue", "https://sqs.us-east-1.api.aws/123456789012/queue", false},
+		{"https://sqs.cn-north-1.amazonaws.com.cn/123456789012/queue", "https://sqs.cn-north-1.api.amazonwebservices.com.cn/123456789012/queue", false},
+		{"https://us-west-2.queue.amazonaws.com/123456789012/queue", "https://sqs.us-west-2.api.aws/123456789012/queue", false},
+		{"https://sqs.us-east-1.api.aws/123456789012/queue", "https://sqs.us-east-1.api.aws/123456789012/queue", false},
+		{"http://localhost:9324/queue", "", true},
+		{"https://sns.us-east-1.amazonaws.com/123456789012/queue", "", true},
+	}
+
+	for _, tt := range tests {
+		q, err := NewQueue(tt.queueURL).UseDualstack()
+		if tt.err {
+			if err == nil {
+				t.Errorf("%s: accepted as %q", tt.queueURL, q.URL())
+			}
+			continue
+		} else if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.queueURL, err)
+			continue
+		}
+
+		if q.URL() != tt.want {
+			t.Errorf("%s: URL = %q, want %q", tt.queueURL, q.URL(), tt.want)
+		}
+
+		// requests are sent to, and signed for, the dualstack host
+		rawURL, err := q.ReceiveMessagesURL(NewContext("id", "key"), ReceiveOptions{MaxMessages: 1})
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.queueURL, err)
+			continue
+		}
+
+		req, err := http.NewRequest("GET", rawURL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want, _ := url.Parse(tt.want)
+		signString, err := NewContext("id", "key").StringToSign(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if req.URL.Host != want.Host || !strings.HasPrefix(signString, "GET\n"+want.Host+"\n") {
+			t.Errorf("%s: request to %s signed as:\n%s", tt.queueURL, req.URL.Host, signString)
+		}
+		if !validTestSignature(t, NewContext("id", "key"), req) {
+			t.Errorf("%s: invalid signature", tt.queueURL)
+		}
+	}
+}
+
+func TestTopicDualstack(t *testing.T) {
+
+	tests := []struct {
+		arn  string
+		want string
+	}{
+		{"arn:aws:sns:us-east-1:123456789012:topic", "https://sns.us-east-1.api.aws/"},
+		{"arn:aws:sns:ap-southeast-2:123456789012:topic", "https://sns.ap-southeast-2.api.aws/"},
+		{"arn:aws-cn:sns:cn-north-1:123456789012:topic", "https://sns.cn-north-1.api.amazonwebservices.com.cn/"},
+	}
+
+	for _, tt := range tests {
+		topic := NewTopic("sns.us-east-1.amazonaws.com", tt.arn)
+		topic.Dualstack = true
+
+		endpoint, err := topic.endpoint()
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.arn, err)
+		} else if endpoint != tt.want {
+			t.Errorf("%s: endpoint = %q, want %q", tt.arn, endpoint, tt.want)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+// Copyright 2012 Matthew Endsley
+// All rights reserved
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted providing that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+// STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+// IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package goaws
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+)
+
+// An error returned by an AWS service.
+type AWSError struct {
+	Type       string
+	Code       string
+	Message    string
+	RequestId  string
+	StatusCode int
+
+	// Every error entry in the response, including the first one
+	// (which is reported by Code and Message). Services such as FPS
+	// may return several entries that together explain a failure.
+	Entries []AWSErrorEntry
+}
+
+// A single entry in a service error response.
+type AWSErrorEntry struct {
+	Code    string
+	Message string
+}
+
+func (e *AWSError) Error() string {
+	return "Amazon returned an error: (" + e.Code + ") " + e.Message
+}
+
+// Returned, wrapping the service error, when creating a queue that
+// already exists with different attributes.
+var ErrAttributesMismatch = errors.New("Already exists with different attributes")
+
+// Decode the error document from a failed query API response.
+func decodeError(resp *http.Response) error {
+
+	var response struct {
+		Error struct {
+			Type    string
+			Code    string
+			Message string
+		}
+		RequestId string
+	}
+
+	if err := xml.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return errors.New("Malformed error response (" + resp.Status + "): " + err.Error())
+	}
+
+	return &AWSError{
+		Type:       response.Error.Type,
+		Code:       response.Error.Code,
+		Message:    response.Error.Message,
+		RequestId:  response.RequestId,
+		StatusCode: resp.StatusCode,
+	}
+}
+
+// Error block of an FPS response.
+type fpsErrorResponse struct {
+	Errors struct {
+		Error []AWSErrorEntry
+	}
+	RequestID string
+}
+
+// Get the error described by an FPS response, or nil if the response
+// does not contain any errors.
+func (r fpsErrorResponse) err() error {
+	if len(r.Errors.Error) == 0 {
+		return nil
+	}
+
+	return &AWSError{
+		Code:      r.Errors.Error[0].Code,
+		Message:   r.Errors.Error[0].Message,
+		RequestId: r.RequestID,
+		Entries:   r.Errors.Error,
+	}
+}
+
+// Send a signed query API request and decode the response into `v`.
+// Service errors are returned as an *AWSError. `v` may be nil if the
+// response carries no interesting data.
+func (c Context) call(r *http.Request, v interface{}) error {
+
+	resp, err := c.do(r, 0)
+	if err != nil {
+		return fmt.Errorf("Failed to do request: %w", err)
+	}
+
+	defer closeBody(resp)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return decodeError(resp)
+	}
+
+	if v == nil {
+		return nil
+	}
+
+	if err := xml.NewDecoder(resp.Body).Decode(v); err != nil {
+		return errors.New("Malformed response: " + err.Error())
+	}
+
+	return nil
+}
+
+// Error codes AWS services use for throttling and transient server
+// failures.
+var transientErrorCodes = map[string]bool{
+	"InternalError":                  true,
+	"InternalFailure":                true,
+	"RequestThrottled":               true,
+	"RequestTimeout":                 true,
+	"ServiceUnavailable":             true,
+	"Throttling":                     true,
+	"ThrottlingException":            true,
+	"AWS.SimpleQueueService.Timeout": true,
+}
+
+// Check whether an error is transient: a network failure (DNS errors,
+// refused or reset connections, timeouts), throttling or a server
+// failure, which is likely to succeed if retried later. Other errors,
+// such as authentication failures, invalid parameters, missing queues
+// or untrusted certificates, indicate misconfiguration and won't go
+// away on their own. Cancellation of the caller's context is not
+// transient.
+func IsTransient(err error) bool {
+
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var awsErr *AWSError
+	if errors.As(err, &awsErr) {
+		switch awsErr.StatusCode {
+		case http.StatusTooManyRequests,
+			http.StatusInternalServerError,
+			http.StatusBadGateway,
+			http.StatusServiceUnavailable,
+			http.StatusGatewayTimeout:
+			return true
+		}
+
+		return transientErrorCodes[awsErr.Code]
+	}
+
+	var unknownAuthority x509.UnknownAuthorityError
+	var hostname x509.HostnameError
+	var invalid x509.CertificateInvalidError
+	if errors.As(err, &unknownAuthority) || errors.As(err, &hostname) || errors.As(err, &invalid) {
+		return false
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, io.EOF)
+}
+
+// Service names reported by PingError.
+const (
+	ServiceSQS = "sqs"
+	ServiceSNS = "sns"
+	ServiceFPS = "fps"
+)
+
+// Returned by the Ping methods when a service cannot be reached or
+// rejects the request.
+type PingError struct {
+	Service string
+	Err     error
+}
+
+func (e *PingError) Error() string {
+	return "Failed to ping " + e.Service + ": " + e.Err.Error()
+}
+
+func (e *PingError) Unwrap() error {
+	return e.Err
+}
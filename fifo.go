@@ -0,0 +1,126 @@
+// Copyright 2012 Matthew Endsley
+// All rights reserved
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted providing that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+// STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+// IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package goaws
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Received messages of one FIFO message group, in order.
+type MessageGroup struct {
+	GroupId  string
+	Messages []SQSMessage
+}
+
+// System attributes required to order FIFO messages. Include them in
+// the receive's AttributeNames.
+var FIFOOrderingAttributes = []string{"MessageGroupId", "SequenceNumber"}
+
+// Compare two FIFO sequence numbers, which are decimal strings of up
+// to 128 bits.
+func sequenceLess(a, b string) bool {
+	if len(a) != len(b) {
+		return len(a) < len(b)
+	}
+
+	return a < b
+}
+
+// Group messages received from a FIFO queue by message group, ordering
+// each group by sequence number. Groups are returned in the order they
+// first appear. The messages must have been received with the
+// FIFOOrderingAttributes system attributes.
+func GroupMessages(messages []SQSMessage) ([]MessageGroup, error) {
+
+	var groups []MessageGroup
+	index := make(map[string]int)
+	for _, m := range messages {
+		groupId := m.SystemAttributes["MessageGroupId"]
+		if groupId == "" || m.SystemAttributes["SequenceNumber"] == "" {
+			return nil, errors.New("Message " + m.MessageId + " was received without its MessageGroupId and SequenceNumber attributes")
+		}
+
+		ii, ok := index[groupId]
+		if !ok {
+			ii = len(groups)
+			index[groupId] = ii
+			groups = append(groups, MessageGroup{GroupId: groupId})
+		}
+		groups[ii].Messages = append(groups[ii].Messages, m)
+	}
+
+	for _, group := range groups {
+		sort.SliceStable(group.Messages, func(i, j int) bool {
+			return sequenceLess(group.Messages[i].SystemAttributes["SequenceNumber"], group.Messages[j].SystemAttributes["SequenceNumber"])
+		})
+	}
+
+	return groups, nil
+}
+
+// Handle messages received from a FIFO queue strictly in order within
+// each message group. Each message is deleted once its handler returns
+// nil, before the next message of its group is handled. When a handler
+// fails, the rest of its group is left unhandled, to be redelivered in
+// order once the visibility timeout expires. Groups are handled
+// concurrently. Returns the handler and delete errors, joined.
+func (q Queue) HandleInOrder(c Context, messages []SQSMessage, handler func(SQSMessage) error) error {
+
+	groups, err := GroupMessages(messages)
+	if err != nil {
+		return err
+	}
+
+	var mu sync.Mutex
+	var errs []error
+	var wg sync.WaitGroup
+	for _, group := range groups {
+		wg.Add(1)
+		go func(group MessageGroup) {
+			defer wg.Done()
+			for _, m := range group.Messages {
+				err := handler(m)
+				if err == nil {
+					err = q.DeleteReceived(c, m)
+				} else {
+					err = fmt.Errorf("Message %s of group %s: %w", m.MessageId, group.GroupId, err)
+				}
+
+				if err != nil {
+					mu.Lock()
+					errs = append(errs, err)
+					mu.Unlock()
+					return
+				}
+			}
+		}(group)
+	}
+
+	wg.Wait()
+	return errors.Join(errs...)
+}
@@ -0,0 +1,3 @@
+module github.com/mendsley/goaws
+
+go 1.21
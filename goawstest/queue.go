@@ -0,0 +1,184 @@
+// Copyright 2012 Matthew Endsley
+// All rights reserved
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted providing that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+// STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+// IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package goawstest
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mendsley/goaws"
+)
+
+// Visibility timeout applied by FakeQueue when a receive doesn't
+// specify one.
+const defaultVisibilityTimeout = 5 * time.Second
+
+// An in-memory SQS queue. Messages sent to the queue can be received,
+// hidden for their visibility timeout, and deleted. The zero value is
+// an empty queue ready for use.
+type FakeQueue struct {
+	mu       sync.Mutex
+	sent     []goaws.SendMessageInput
+	messages []*fakeMessage
+	nextId   int
+}
+
+type fakeMessage struct {
+	id            string
+	receiptHandle string
+	input         goaws.SendMessageInput
+	visibleAt     time.Time
+}
+
+var _ goaws.MessageQueue = (*FakeQueue)(nil)
+
+// Add a message to the queue.
+func (q *FakeQueue) Send(c goaws.Context, msg goaws.SendMessageInput) (goaws.SendMessageResult, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.nextId++
+	m := &fakeMessage{
+		id:    strconv.Itoa(q.nextId),
+		input: msg,
+	}
+
+	q.sent = append(q.sent, msg)
+	q.messages = append(q.messages, m)
+
+	return goaws.SendMessageResult{
+		MessageId: m.id,
+	}, nil
+}
+
+// Receive visible messages from the queue, hiding them for the
+// requested visibility timeout. A MaxMessages of 0 receives at most one
+// message, as SQS does. Never waits for messages to arrive.
+func (q *FakeQueue) ReceiveMessagesWithOptions(c goaws.Context, opts goaws.ReceiveOptions) ([]goaws.SQSMessage, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	max := opts.MaxMessages
+	if max < 0 || max > goaws.MaxReceiveMessages {
+		return nil, fmt.Errorf("%w: must be between 0 and %d. Got: %d", goaws.ErrMaxMessagesRange, goaws.MaxReceiveMessages, max)
+	} else if max == 0 {
+		max = 1
+	}
+
+	visibility := defaultVisibilityTimeout
+	if opts.VisibilityTimeout != nil {
+		visibility = *opts.VisibilityTimeout
+	}
+
+	now := time.Now()
+	var received []goaws.SQSMessage
+	for _, m := range q.messages {
+		if len(received) >= max {
+			break
+		} else if now.Before(m.visibleAt) {
+			continue
+		}
+
+		q.nextId++
+		m.receiptHandle = m.id + "-" + strconv.Itoa(q.nextId)
+		m.visibleAt = now.Add(visibility)
+
+		var system map[string]string
+		if m.input.AWSTraceHeader != "" {
+			system = map[string]string{"AWSTraceHeader": m.input.AWSTraceHeader}
+		}
+
+		received = append(received, goaws.SQSMessage{
+			MessageId:         m.id,
+			ReceiptHandle:     m.receiptHandle,
+			Body:              m.input.Body,
+			MessageAttributes: m.input.MessageAttributes,
+			SystemAttributes:  system,
+			AWSTraceHeader:    m.input.AWSTraceHeader,
+		})
+	}
+
+	return received, nil
+}
+
+// Find a message by its current receipt handle. Must be called with the
+// lock held.
+func (q *FakeQueue) find(receiptHandle string) (int, error) {
+	for ii, m := range q.messages {
+		if m.receiptHandle == receiptHandle {
+			return ii, nil
+		}
+	}
+
+	return -1, errors.New("Unknown receipt handle: " + receiptHandle)
+}
+
+// Remove a received message from the queue.
+func (q *FakeQueue) DeleteMessage(c goaws.Context, receiptHandle string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	ii, err := q.find(receiptHandle)
+	if err != nil {
+		return err
+	}
+
+	q.messages = append(q.messages[:ii], q.messages[ii+1:]...)
+	return nil
+}
+
+// Change how long a received message stays hidden.
+func (q *FakeQueue) ChangeMessageVisibility(c goaws.Context, receiptHandle string, timeout time.Duration) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	ii, err := q.find(receiptHandle)
+	if err != nil {
+		return err
+	}
+
+	q.messages[ii].visibleAt = time.Now().Add(timeout)
+	return nil
+}
+
+// Get every message sent to the queue, in order, including deleted
+// messages.
+func (q *FakeQueue) Sent() []goaws.SendMessageInput {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return append([]goaws.SendMessageInput(nil), q.sent...)
+}
+
+// Get the number of messages remaining in the queue, visible or not.
+func (q *FakeQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return len(q.messages)
+}
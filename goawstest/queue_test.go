@@ -0,0 +1,95 @@
+// Copyright 2012 Matthew Endsley
+// All rights reserved
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted providing that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+// STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+// IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package goawstest
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/mendsley/goaws"
+)
+
+func TestFakeQueue(t *testing.T) {
+
+	var q goaws.MessageQueue = &FakeQueue{}
+	c := goaws.NewContext("id", "key")
+
+	for _, body := range []string{"one", "two", "three"} {
+		if _, err := q.Send(c, goaws.SendMessageInput{Body: body}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	// a zero MaxMessages receives a single message, as SQS does
+	received, err := q.ReceiveMessagesWithOptions(c, goaws.ReceiveOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(received) != 1 || received[0].Body != "one" {
+		t.Fatalf("received %+v, want message one", received)
+	}
+	first := received[0]
+
+	// received messages stay hidden
+	received, err = q.ReceiveMessagesWithOptions(c, goaws.ReceiveOptions{MaxMessages: goaws.MaxReceiveMessages})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(received) != 2 {
+		t.Fatalf("received %d messages, want 2", len(received))
+	}
+	if received, _ = q.ReceiveMessagesWithOptions(c, goaws.ReceiveOptions{MaxMessages: 1}); len(received) != 0 {
+		t.Errorf("received hidden messages: %+v", received)
+	}
+
+	// until their visibility timeout changes
+	if err := q.ChangeMessageVisibility(c, first.ReceiptHandle, 0); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	received, _ = q.ReceiveMessagesWithOptions(c, goaws.ReceiveOptions{MaxMessages: 1})
+	if len(received) != 1 || received[0].MessageId != first.MessageId {
+		t.Fatalf("received %+v, want message %s again", received, first.MessageId)
+	}
+
+	// a receive issues a new receipt handle
+	if err := q.DeleteMessage(c, first.ReceiptHandle); err == nil {
+		t.Errorf("deleted with a stale receipt handle")
+	}
+	if err := q.DeleteMessage(c, received[0].ReceiptHandle); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if n := q.(*FakeQueue).Len(); n != 2 {
+		t.Errorf("Len() = %d, want 2", n)
+	}
+	if sent := q.(*FakeQueue).Sent(); len(sent) != 3 {
+		t.Errorf("Sent() = %+v, want 3 messages", sent)
+	}
+
+	for _, max := range []int{-1, goaws.MaxReceiveMessages + 1} {
+		if _, err := q.ReceiveMessagesWithOptions(c, goaws.ReceiveOptions{MaxMessages: max}); !errors.Is(err, goaws.ErrMaxMessagesRange) {
+			t.Errorf("MaxMessages %d: error = %v, want ErrMaxMessagesRange", max, err)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright 2012 Matthew Endsley
+// All rights reserved
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted providing that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+// STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+// IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package goawstest
+
+import (
+	"errors"
+	"net/url"
+	"sync"
+
+	"github.com/mendsley/goaws"
+)
+
+// An in-memory SimplePay store. Transactions are considered successful
+// unless listed in Failed. The zero value is ready for use.
+type FakeStore struct {
+	// Errors returned by GetTransactionStatus, keyed by transaction
+	// id.
+	Failed map[string]error
+
+	// Error returned by VerifyPaymentParams, if any.
+	VerifyErr error
+
+	mu      sync.Mutex
+	settled map[string]goaws.Money
+}
+
+var _ goaws.PaymentStore = (*FakeStore)(nil)
+
+// Create a fake purchase URL encoding the item.
+func (s *FakeStore) CreatePurchaseURL(c goaws.Context, item goaws.Purchase) (string, error) {
+	params := make(url.Values)
+	params.Set("description", item.Description)
+	params.Set("amount", item.Amount.String())
+	if item.Amount.Currency == "" {
+		params.Set("amount", item.Price)
+	}
+	params.Set("referenceId", item.ReferenceId)
+
+	return "https://payments.invalid/purchase?" + params.Encode(), nil
+}
+
+// Get the status of a transaction.
+func (s *FakeStore) GetTransactionStatus(c goaws.Context, transactionId string) error {
+	return s.Failed[transactionId]
+}
+
+// Record a settlement.
+func (s *FakeStore) Settle(c goaws.Context, transactionId string, amount goaws.Money) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.settled[transactionId]; ok {
+		return errors.New("Transaction already settled: " + transactionId)
+	}
+
+	if s.settled == nil {
+		s.settled = make(map[string]goaws.Money)
+	}
+	s.settled[transactionId] = amount
+	return nil
+}
+
+// Verify payment parameters.
+func (s *FakeStore) VerifyPaymentParams(c goaws.Context, v url.Values) error {
+	return s.VerifyErr
+}
+
+// Get the amount a transaction was settled for.
+func (s *FakeStore) Settled(transactionId string) (goaws.Money, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	amount, ok := s.settled[transactionId]
+	return amount, ok
+}
@@ -0,0 +1,77 @@
+// Copyright 2012 Matthew Endsley
+// All rights reserved
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted providing that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+// STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+// IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package goawstest
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/mendsley/goaws"
+)
+
+func TestFakeStore(t *testing.T) {
+
+	failure := errors.New("declined")
+	var store goaws.PaymentStore = &FakeStore{
+		Failed:    map[string]error{"declined": failure},
+		VerifyErr: failure,
+	}
+	c := goaws.NewContext("id", "key")
+
+	purchaseURL, err := store.CreatePurchaseURL(c, goaws.Purchase{
+		Description: "item",
+		Amount:      goaws.Money{Currency: "USD", Amount: 1234},
+		ReferenceId: "ref",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(purchaseURL, "amount=USD+12.34") {
+		t.Errorf("purchase URL %s doesn't encode the amount", purchaseURL)
+	}
+
+	if err := store.GetTransactionStatus(c, "approved"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := store.GetTransactionStatus(c, "declined"); err != failure {
+		t.Errorf("error = %v, want %v", err, failure)
+	}
+	if err := store.VerifyPaymentParams(c, url.Values{}); err != failure {
+		t.Errorf("error = %v, want %v", err, failure)
+	}
+
+	amount := goaws.Money{Currency: "USD", Amount: 100}
+	if err := store.Settle(c, "txn", amount); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := store.Settle(c, "txn", amount); err == nil {
+		t.Errorf("settled a transaction twice")
+	}
+	if settled, ok := store.(*FakeStore).Settled("txn"); !ok || settled != amount {
+		t.Errorf("Settled() = %v, %v", settled, ok)
+	}
+}
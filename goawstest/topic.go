@@ -0,0 +1,60 @@
+// Copyright 2012 Matthew Endsley
+// All rights reserved
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted providing that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+// STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+// IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package goawstest
+
+import (
+	"strconv"
+	"sync"
+
+	"github.com/mendsley/goaws"
+)
+
+// An in-memory SNS topic recording published messages. The zero value
+// is ready for use.
+type FakeTopic struct {
+	mu        sync.Mutex
+	published []string
+}
+
+var _ goaws.Publisher = (*FakeTopic)(nil)
+
+// Record a published message.
+func (t *FakeTopic) PublishResult(c goaws.Context, body string) (goaws.PublishResult, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.published = append(t.published, body)
+	return goaws.PublishResult{
+		MessageId: strconv.Itoa(len(t.published)),
+	}, nil
+}
+
+// Get every message published to the topic, in order.
+func (t *FakeTopic) Published() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return append([]string(nil), t.published...)
+}
@@ -0,0 +1,93 @@
+// Copyright 2012 Matthew Endsley
+// All rights reserved
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted providing that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+// STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+// IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package goaws
+
+import (
+	"sync"
+	"time"
+)
+
+// Default settings for a PublishCache.
+const (
+	DefaultPublishCacheTTL        = defaultCacheTTL
+	DefaultPublishCacheMaxEntries = defaultCacheMaxEntries
+)
+
+// A bounded in-memory record of recent publishes, keyed by a caller
+// supplied idempotency key. Used by Topic.PublishIdempotent to avoid
+// publishing the same message twice within a process.
+//
+// Entries expire after the cache's TTL. When full, the least recently
+// used entry is evicted. A PublishCache is safe for concurrent use.
+type PublishCache struct {
+	mu      sync.Mutex
+	results *ttlCache[PublishResult]
+}
+
+// Create a publish cache. Zero values use the default TTL and size.
+func NewPublishCache(ttl time.Duration, maxEntries int) *PublishCache {
+	return &PublishCache{
+		results: newTTLCache[PublishResult](ttl, maxEntries),
+	}
+}
+
+func (pc *PublishCache) get(key string) (PublishResult, bool) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	return pc.results.get(key)
+}
+
+func (pc *PublishCache) put(key string, result PublishResult) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	if _, ok := pc.results.get(key); !ok {
+		pc.results.put(key, result)
+	}
+}
+
+// Publish a message to the SNS topic unless a message with the same
+// idempotency key was already published through `cache`, in which case
+// the earlier result is returned without publishing again.
+//
+// This only guards against duplicates within the process. Concurrent
+// publishes with the same key that are both in flight may still both
+// be sent.
+func (t Topic) PublishIdempotent(c Context, cache *PublishCache, key, body string) (PublishResult, error) {
+
+	cacheKey := t.arn + "\x00" + key
+	if result, ok := cache.get(cacheKey); ok {
+		return result, nil
+	}
+
+	result, err := t.PublishResult(c, body)
+	if err != nil {
+		return PublishResult{}, err
+	}
+
+	cache.put(cacheKey, result)
+	return result, nil
+}
@@ -0,0 +1,60 @@
+// Copyright 2012 Matthew Endsley
+// All rights reserved
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted providing that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+// STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+// IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package goaws
+
+import (
+	"net/url"
+	"time"
+)
+
+// Operations on an SQS queue. Implemented by Queue, and by the fakes in
+// the goawstest package for testing code that uses SQS.
+type MessageQueue interface {
+	Send(c Context, msg SendMessageInput) (SendMessageResult, error)
+	ReceiveMessagesWithOptions(c Context, opts ReceiveOptions) ([]SQSMessage, error)
+	DeleteMessage(c Context, receiptHandle string) error
+	ChangeMessageVisibility(c Context, receiptHandle string, timeout time.Duration) error
+}
+
+// Publishes messages to an SNS topic. Implemented by Topic, and by the
+// fakes in the goawstest package.
+type Publisher interface {
+	PublishResult(c Context, body string) (PublishResult, error)
+}
+
+// Payment operations of a SimplePay store. Implemented by Store, and by
+// the fakes in the goawstest package.
+type PaymentStore interface {
+	CreatePurchaseURL(c Context, item Purchase) (string, error)
+	GetTransactionStatus(c Context, transactionId string) error
+	Settle(c Context, transactionId string, amount Money) error
+	VerifyPaymentParams(c Context, v url.Values) error
+}
+
+var (
+	_ MessageQueue = Queue{}
+	_ Publisher    = Topic{}
+	_ PaymentStore = Store{}
+)
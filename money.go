@@ -0,0 +1,118 @@
+// Copyright 2012 Matthew Endsley
+// All rights reserved
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted providing that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+// STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+// IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package goaws
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// An amount of money in a specific currency.
+type Money struct {
+	// ISO 4217 currency code, e.g. "USD".
+	Currency string
+
+	// Amount in minor units (e.g. cents).
+	Amount int64
+}
+
+// Parse an amount formatted as "<currency> [-]<major>[.<minor>]", e.g.
+// "USD 12.34". At most two decimal places are accepted.
+func ParseMoney(s string) (Money, error) {
+
+	parts := strings.SplitN(s, " ", 2)
+	if len(parts) != 2 || len(parts[0]) != 3 {
+		return Money{}, errors.New("Malformed amount: " + s)
+	}
+
+	major, minor := parts[1], ""
+	negative := strings.HasPrefix(major, "-")
+	if negative {
+		major = major[1:]
+	}
+
+	if dot := strings.IndexByte(major, '.'); dot != -1 {
+		major, minor = major[:dot], major[dot+1:]
+		if len(minor) == 0 || len(minor) > 2 {
+			return Money{}, errors.New("Malformed amount: " + s)
+		}
+	}
+
+	for len(minor) < 2 {
+		minor += "0"
+	}
+
+	// ParseUint rejects signs, so only the leading '-' is accepted
+	units, err := strconv.ParseUint(major, 10, 64)
+	if err != nil {
+		return Money{}, errors.New("Malformed amount: " + s)
+	}
+
+	cents, err := strconv.ParseUint(minor, 10, 64)
+	if err != nil {
+		return Money{}, errors.New("Malformed amount: " + s)
+	}
+
+	limit := uint64(math.MaxInt64)
+	if negative {
+		limit++
+	}
+	if units > (limit-cents)/100 {
+		return Money{}, errors.New("Amount out of range: " + s)
+	}
+
+	amount := int64(units*100 + cents)
+	if negative {
+		amount = -amount
+	}
+
+	return Money{
+		Currency: parts[0],
+		Amount:   amount,
+	}, nil
+}
+
+// Get the decimal value of the amount, e.g. "12.34" or "-0.05".
+func (m Money) Value() string {
+
+	sign, abs := "", uint64(m.Amount)
+	if m.Amount < 0 {
+		sign, abs = "-", -abs
+	}
+
+	cents := strconv.FormatUint(abs%100, 10)
+	if len(cents) < 2 {
+		cents = "0" + cents
+	}
+
+	return sign + strconv.FormatUint(abs/100, 10) + "." + cents
+}
+
+// Format the amount as "<currency> <value>", e.g. "USD 12.34".
+func (m Money) String() string {
+	return m.Currency + " " + m.Value()
+}
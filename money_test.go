@@ -0,0 +1,120 @@
+// Copyright 2012 Matthew Endsley
+// All rights reserved
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted providing that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+// STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+// IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package goaws
+
+import (
+	"math"
+	"testing"
+)
+
+func TestMoneyValue(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		amount int64
+		want   string
+	}{
+		{"zero", 0, "0.00"},
+		{"cents", 5, "0.05"},
+		{"dollars", 1234, "12.34"},
+		{"negative cents", -5, "-0.05"},
+		{"negative dollars", -1234, "-12.34"},
+		{"negative whole", -100, "-1.00"},
+		{"largest", math.MaxInt64, "92233720368547758.07"},
+		{"smallest", math.MinInt64, "-92233720368547758.08"},
+	}
+
+	for _, tt := range tests {
+		m := Money{Currency: "USD", Amount: tt.amount}
+		if got := m.Value(); got != tt.want {
+			t.Errorf("%s: Value() = %q, want %q", tt.name, got, tt.want)
+		}
+		if got := m.String(); got != "USD "+tt.want {
+			t.Errorf("%s: String() = %q, want %q", tt.name, got, "USD "+tt.want)
+		}
+	}
+}
+
+func TestParseMoney(t *testing.T) {
+
+	tests := []struct {
+		in   string
+		want Money
+		err  bool
+	}{
+		{"USD 12.34", Money{"USD", 1234}, false},
+		{"USD 12.3", Money{"USD", 1230}, false},
+		{"USD 12", Money{"USD", 1200}, false},
+		{"USD 0", Money{"USD", 0}, false},
+		{"USD 0.05", Money{"USD", 5}, false},
+		{"USD -0.05", Money{"USD", -5}, false},
+		{"USD -12.34", Money{"USD", -1234}, false},
+		{"USD 92233720368547758.07", Money{"USD", math.MaxInt64}, false},
+		{"USD -92233720368547758.08", Money{"USD", math.MinInt64}, false},
+
+		{"USD 92233720368547758.08", Money{}, true},
+		{"USD -92233720368547758.09", Money{}, true},
+		{"USD 92233720368547759", Money{}, true},
+		{"USD 99999999999999999999", Money{}, true},
+		{"USD 12.345", Money{}, true},
+		{"USD 12.", Money{}, true},
+		{"USD .5", Money{}, true},
+		{"USD +1", Money{}, true},
+		{"USD --1", Money{}, true},
+		{"USD 1.-5", Money{}, true},
+		{"USD 1.+5", Money{}, true},
+		{"USD -", Money{}, true},
+		{"USD", Money{}, true},
+		{"US 1.00", Money{}, true},
+		{"12.34", Money{}, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseMoney(tt.in)
+		if tt.err != (err != nil) {
+			t.Errorf("ParseMoney(%q): error = %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseMoney(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestMoneyRoundTrip(t *testing.T) {
+
+	amounts := []int64{0, 1, -1, 5, -5, 99, -99, 100, -100, 1234, -1234, 1 << 40, -1 << 40, math.MaxInt64, math.MinInt64}
+	for _, amount := range amounts {
+		m := Money{Currency: "EUR", Amount: amount}
+		got, err := ParseMoney(m.String())
+		if err != nil {
+			t.Errorf("ParseMoney(%q): unexpected error: %v", m.String(), err)
+			continue
+		}
+		if got != m {
+			t.Errorf("ParseMoney(%q) = %+v, want %+v", m.String(), got, m)
+		}
+	}
+}
@@ -0,0 +1,271 @@
+// Copyright 2012 Matthew Endsley
+// All rights reserved
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted providing that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+// STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+// IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package goaws
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+)
+
+// A notification delivered by SNS, as found in the JSON envelope sent
+// to HTTP endpoints and (without raw message delivery) SQS queues.
+type SNSNotification struct {
+	Type              string
+	MessageId         string
+	Token             string
+	TopicArn          string
+	Subject           string
+	Message           string
+	Timestamp         time.Time
+	SignatureVersion  string
+	Signature         string
+	SigningCertURL    string
+	SubscribeURL      string
+	UnsubscribeURL    string
+	MessageAttributes map[string]struct {
+		Type  string
+		Value string
+	}
+
+	// Value of the x-amz-sns-message-type header the notification was
+	// delivered with, as set by ParseNotification.
+	MessageTypeHeader string `json:"-"`
+
+	// Timestamp exactly as sent, which is what SNS signs.
+	rawTimestamp string
+}
+
+// Maximum size of a notification delivered to an HTTP endpoint: the
+// largest message plus room for the JSON envelope.
+const maxNotificationSize = DefaultMaxMessageSize + 64*1024
+
+// Parse a notification delivered by SNS to an HTTP endpoint. The
+// x-amz-sns-message-type and x-amz-sns-topic-arn headers must match
+// the notification's Type and TopicArn, since a mismatch indicates a
+// malformed or spoofed delivery. The notification's signature is not
+// checked; use SNSNotification.Verify.
+func ParseNotification(r *http.Request) (*SNSNotification, error) {
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxNotificationSize+1))
+	if err != nil {
+		return nil, errors.New("Failed to read notification: " + err.Error())
+	} else if len(body) > maxNotificationSize {
+		return nil, errors.New("Notification too large")
+	}
+
+	n := new(SNSNotification)
+	if err := json.Unmarshal(body, n); err != nil {
+		return nil, errors.New("Malformed SNS notification: " + err.Error())
+	}
+
+	n.MessageTypeHeader = r.Header.Get("x-amz-sns-message-type")
+	if n.MessageTypeHeader != n.Type {
+		return nil, errors.New("Message type header " + n.MessageTypeHeader + " does not match notification type " + n.Type)
+	}
+
+	if topicArn := r.Header.Get("x-amz-sns-topic-arn"); topicArn != n.TopicArn {
+		return nil, errors.New("Topic ARN header " + topicArn + " does not match notification topic " + n.TopicArn)
+	}
+
+	return n, nil
+}
+
+func (n *SNSNotification) UnmarshalJSON(data []byte) error {
+	type notification SNSNotification
+	var raw struct {
+		notification
+		Timestamp string
+	}
+
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	*n = SNSNotification(raw.notification)
+	n.rawTimestamp = raw.Timestamp
+	if raw.Timestamp != "" {
+		timestamp, err := time.Parse(time.RFC3339Nano, raw.Timestamp)
+		if err != nil {
+			return errors.New("Malformed timestamp: " + err.Error())
+		}
+		n.Timestamp = timestamp
+	}
+
+	return nil
+}
+
+// Verify the notification's signature using the Amazon certificate at
+// its SigningCertURL. The URL must be an SNS signing certificate served
+// over https by an SNS regional endpoint, and the certificate must
+// chain to a trusted root and be issued to SNS.
+func (n *SNSNotification) Verify(c Context) error {
+
+	timestamp := n.rawTimestamp
+	if timestamp == "" {
+		timestamp = n.Timestamp.UTC().Format("2006-01-02T15:04:05.000Z")
+	}
+
+	// Signed fields, in the order SNS signs them
+	var fields [][2]string
+	switch n.Type {
+	case "Notification":
+		fields = append(fields, [2]string{"Message", n.Message}, [2]string{"MessageId", n.MessageId})
+		if n.Subject != "" {
+			fields = append(fields, [2]string{"Subject", n.Subject})
+		}
+		fields = append(fields, [2]string{"Timestamp", timestamp}, [2]string{"TopicArn", n.TopicArn}, [2]string{"Type", n.Type})
+
+	case "SubscriptionConfirmation", "UnsubscribeConfirmation":
+		fields = [][2]string{
+			{"Message", n.Message},
+			{"MessageId", n.MessageId},
+			{"SubscribeURL", n.SubscribeURL},
+			{"Timestamp", timestamp},
+			{"Token", n.Token},
+			{"TopicArn", n.TopicArn},
+			{"Type", n.Type},
+		}
+
+	default:
+		return errors.New("Unknown SNS message type: " + n.Type)
+	}
+
+	var signString []byte
+	for _, field := range fields {
+		signString = append(signString, field[0]+"\n"+field[1]+"\n"...)
+	}
+
+	var hash crypto.Hash
+	var digest []byte
+	switch n.SignatureVersion {
+	case "1":
+		sum := sha1.Sum(signString)
+		hash, digest = crypto.SHA1, sum[:]
+	case "2":
+		sum := sha256.Sum256(signString)
+		hash, digest = crypto.SHA256, sum[:]
+	default:
+		return errors.New("Unsupported signature version: " + n.SignatureVersion)
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(n.Signature)
+	if err != nil {
+		return errors.New("Malformed signature: " + err.Error())
+	}
+
+	cert, err := fetchSNSCertificate(c, n.SigningCertURL)
+	if err != nil {
+		return err
+	}
+
+	pub, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return errors.New("Certificate does not contain an RSA key")
+	}
+
+	if err := rsa.VerifyPKCS1v15(pub, hash, digest, signature); err != nil {
+		return errors.New("Invalid signature: " + err.Error())
+	}
+
+	return nil
+}
+
+// Confirm the subscription announced by a SubscriptionConfirmation
+// notification, as received by an HTTP endpoint. The notification's
+// signature is verified, and its SubscribeURL must be an https URL of
+// an SNS regional endpoint, before the URL is visited.
+func ConfirmSubscriptionFromNotification(c Context, n *SNSNotification) error {
+
+	if n.Type != "SubscriptionConfirmation" {
+		return errors.New("Not a subscription confirmation: " + n.Type)
+	}
+
+	if _, err := validateSNSURL("Subscribe", n.SubscribeURL); err != nil {
+		return err
+	}
+
+	if err := n.Verify(c); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("GET", n.SubscribeURL, nil)
+	if err != nil {
+		return errors.New("Failed to create request: " + err.Error())
+	}
+
+	return c.call(req, nil)
+}
+
+// Unwrap an SNS notification delivered to an SQS queue. Returns false
+// (and no error) if the message body is not an SNS envelope, e.g. when
+// the subscription uses raw message delivery. The published message is
+// available as the notification's Message.
+func UnwrapSNS(m SQSMessage) (*SNSNotification, bool, error) {
+
+	if len(m.Body) == 0 || m.Body[0] != '{' {
+		return nil, false, nil
+	}
+
+	// Check for the envelope's identifying fields before decoding the
+	// whole notification, so arbitrary JSON bodies aren't errors
+	var probe struct {
+		Type     string
+		TopicArn string
+		Message  *string
+	}
+	if err := json.Unmarshal([]byte(m.Body), &probe); err != nil {
+		return nil, false, nil
+	}
+
+	if probe.Type == "" || probe.TopicArn == "" || probe.Message == nil {
+		return nil, false, nil
+	}
+
+	n := new(SNSNotification)
+	if err := json.Unmarshal([]byte(m.Body), n); err != nil {
+		return nil, false, errors.New("Malformed SNS notification: " + err.Error())
+	}
+
+	return n, true, nil
+}
+
+// Get the external id attached by Topic.PublishWithId, or an empty
+// string if the notification doesn't carry one.
+func (n *SNSNotification) ExternalId() string {
+	attr, ok := n.MessageAttributes[ExternalIdAttribute]
+	if !ok || attr.Type != "String" {
+		return ""
+	}
+
+	return attr.Value
+}
@@ -0,0 +1,145 @@
+// Copyright 2012 Matthew Endsley
+// All rights reserved
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted providing that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+// STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+// IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package goaws
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// Create a SignatureVersion 2 notification signed with `key`.
+func newTestNotification(t *testing.T, key *rsa.PrivateKey, certURL string) *SNSNotification {
+
+	n := &SNSNotification{
+		Type:             "Notification",
+		MessageId:        "message-id",
+		TopicArn:         "arn:aws:sns:us-east-1:123456789012:topic",
+		Message:          "hello",
+		Timestamp:        time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		SignatureVersion: "2",
+		SigningCertURL:   certURL,
+	}
+
+	signString := "Message\nhello\nMessageId\nmessage-id\nTimestamp\n2024-01-02T03:04:05.000Z\nTopicArn\n" + n.TopicArn + "\nType\nNotification\n"
+	digest := sha256.Sum256([]byte(signString))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n.Signature = base64.StdEncoding.EncodeToString(signature)
+	return n
+}
+
+func TestNotificationVerify(t *testing.T) {
+
+	pki := newTestPKI(t)
+	genuine := newTestCert(t, "sns.amazonaws.com", false, pki.intermediate, testIntermediateURL)
+	regional := newTestCert(t, "sns.eu-west-1.amazonaws.com", false, pki.intermediate, testIntermediateURL)
+	wrongName := newTestCert(t, "attacker.example.com", false, pki.intermediate, testIntermediateURL)
+	selfSigned := newTestCert(t, "sns.amazonaws.com", false, nil, "")
+
+	const (
+		genuineURL    = "https://sns.us-east-1.amazonaws.com/SimpleNotificationService-0123abcd.pem"
+		regionalURL   = "https://sns.eu-west-1.amazonaws.com/SimpleNotificationService-0123abcd.pem"
+		wrongNameURL  = "https://sns.us-east-1.amazonaws.com/SimpleNotificationService-wrongname.pem"
+		selfSignedURL = "https://sns.us-east-1.amazonaws.com/SimpleNotificationService-selfsigned.pem"
+		bucketURL     = "https://attacker.s3.amazonaws.com/SimpleNotificationService-0123abcd.pem"
+		gatewayURL    = "https://abc123.execute-api.us-east-1.amazonaws.com/SimpleNotificationService-0123abcd.pem"
+		pathURL       = "https://sns.us-east-1.amazonaws.com/attacker/cert.pem"
+		httpURL       = "http://sns.us-east-1.amazonaws.com/SimpleNotificationService-0123abcd.pem"
+	)
+	pki.transport[genuineURL] = genuine.pem()
+	pki.transport[regionalURL] = regional.pem()
+	pki.transport[wrongNameURL] = wrongName.pem()
+	pki.transport[selfSignedURL] = selfSigned.pem()
+	pki.transport[bucketURL] = selfSigned.pem()
+	pki.transport[gatewayURL] = selfSigned.pem()
+	pki.transport[pathURL] = genuine.pem()
+	pki.transport[httpURL] = genuine.pem()
+
+	c := NewContext("id", "key")
+	c.Transport = pki.transport
+
+	tests := []struct {
+		name    string
+		certURL string
+		key     *rsa.PrivateKey
+		valid   bool
+	}{
+		{"genuine", genuineURL, genuine.key, true},
+		{"issued to the regional host", regionalURL, regional.key, true},
+		{"wrong key", genuineURL, selfSigned.key, false},
+		{"not issued to SNS", wrongNameURL, wrongName.key, false},
+		{"untrusted certificate", selfSignedURL, selfSigned.key, false},
+		{"S3 bucket", bucketURL, selfSigned.key, false},
+		{"API gateway", gatewayURL, selfSigned.key, false},
+		{"not a signing certificate path", pathURL, genuine.key, false},
+		{"plain http", httpURL, genuine.key, false},
+	}
+
+	for _, tt := range tests {
+		err := newTestNotification(t, tt.key, tt.certURL).Verify(c)
+		if tt.valid && err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+		} else if !tt.valid && err == nil {
+			t.Errorf("%s: accepted", tt.name)
+		}
+	}
+}
+
+func TestConfirmSubscriptionRejectsNonSNSURL(t *testing.T) {
+
+	tests := []string{
+		"https://attacker.s3.amazonaws.com/?Action=ConfirmSubscription",
+		"https://abc123.execute-api.us-east-1.amazonaws.com/",
+		"http://sns.us-east-1.amazonaws.com/?Action=ConfirmSubscription",
+		"https://sns.us-east-1.amazonaws.com.attacker.com/",
+	}
+
+	var fetched []string
+	c := NewContext("id", "key")
+	c.Transport = roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		fetched = append(fetched, r.URL.String())
+		return staticTransport{}.RoundTrip(r)
+	})
+
+	for _, subscribeURL := range tests {
+		n := &SNSNotification{Type: "SubscriptionConfirmation", SubscribeURL: subscribeURL}
+		if err := ConfirmSubscriptionFromNotification(c, n); err == nil {
+			t.Errorf("%s: accepted", subscribeURL)
+		}
+	}
+
+	if len(fetched) != 0 {
+		t.Errorf("Fetched URLs from unverified notifications: %v", fetched)
+	}
+}
@@ -0,0 +1,278 @@
+// Copyright 2012 Matthew Endsley
+// All rights reserved
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted providing that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+// STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+// IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package goaws
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// Matches the existing endpoint ARN reported when creating an endpoint
+// for an already registered token.
+var existingEndpointPattern = regexp.MustCompile(`Endpoint (arn:\S+) already exists`)
+
+// Register a mobile device token with an SNS platform application,
+// returning the ARN of the endpoint that can be published to. If the
+// token is already registered, the existing endpoint's ARN is returned.
+// `customUserData` is optional.
+func CreatePlatformEndpoint(c Context, host, platformApplicationArn, token, customUserData string) (endpointArn string, err error) {
+
+	params := make(url.Values)
+	params.Set("PlatformApplicationArn", platformApplicationArn)
+	params.Set("Token", token)
+	if customUserData != "" {
+		params.Set("CustomUserData", customUserData)
+	}
+	params.Set("Action", "CreatePlatformEndpoint")
+
+	req, err := http.NewRequest("GET", "https://"+host+"/?"+params.Encode(), nil)
+	if err != nil {
+		return "", errors.New("Failed to create request: " + err.Error())
+	}
+
+	if err := c.SignRequest(req); err != nil {
+		return "", err
+	}
+
+	var response struct {
+		CreatePlatformEndpointResult struct {
+			EndpointArn string
+		}
+	}
+
+	if err := c.call(req, &response); err != nil {
+		var awsErr *AWSError
+		if errors.As(err, &awsErr) && awsErr.Code == "InvalidParameter" {
+			if m := existingEndpointPattern.FindStringSubmatch(awsErr.Message); m != nil {
+				return m[1], nil
+			}
+		}
+
+		return "", err
+	}
+
+	return response.CreatePlatformEndpointResult.EndpointArn, nil
+}
+
+// Delete a mobile device endpoint.
+func DeleteEndpoint(c Context, host, endpointArn string) error {
+
+	params := make(url.Values)
+	params.Set("EndpointArn", endpointArn)
+	params.Set("Action", "DeleteEndpoint")
+
+	req, err := http.NewRequest("GET", "https://"+host+"/?"+params.Encode(), nil)
+	if err != nil {
+		return errors.New("Failed to create request: " + err.Error())
+	}
+
+	if err := c.SignRequest(req); err != nil {
+		return err
+	}
+
+	return c.call(req, nil)
+}
+
+// Publish a message directly to a mobile device endpoint.
+func PublishToTarget(c Context, host, targetArn, body string) (PublishResult, error) {
+
+	params := make(url.Values)
+	params.Set("TargetArn", targetArn)
+	params.Set("Message", body)
+	params.Set("Action", "Publish")
+
+	req, err := c.newPostRequest("https://"+host+"/", params)
+	if err != nil {
+		return PublishResult{}, err
+	}
+
+	var response struct {
+		PublishResult struct {
+			MessageId string
+		}
+		ResponseMetadata struct {
+			RequestId string
+		}
+	}
+
+	if err := c.call(req, &response); err != nil {
+		return PublishResult{}, err
+	}
+
+	return PublishResult{
+		MessageId:    response.PublishResult.MessageId,
+		RequestId:    response.ResponseMetadata.RequestId,
+		MD5OfMessage: md5Hex(body),
+	}, nil
+}
+
+// Credentials of a push notification platform, used by a platform
+// application to deliver to that platform's devices.
+type PlatformCredentials struct {
+	// Platform name, e.g. "APNS", "APNS_SANDBOX" or "GCM" (Firebase
+	// Cloud Messaging).
+	Platform string
+
+	// The PlatformPrincipal attribute: the SSL certificate for APNS
+	// certificate authentication, or the signing key id for APNS token
+	// authentication. Empty for GCM.
+	Principal string
+
+	// The PlatformCredential attribute: the private key or signing
+	// key for APNS, or the server key for GCM.
+	Credential string
+}
+
+// Add the attributes of a set of platform credentials to `attributes`.
+func (pc PlatformCredentials) attributes(attributes map[string]string) error {
+
+	if pc.Credential == "" {
+		return errors.New("Platform credentials require a credential")
+	}
+
+	switch pc.Platform {
+	case "APNS", "APNS_SANDBOX":
+		if pc.Principal == "" {
+			return errors.New("APNS platform credentials require a principal")
+		}
+	case "":
+		return errors.New("Platform credentials require a platform")
+	}
+
+	attributes["PlatformCredential"] = pc.Credential
+	if pc.Principal != "" {
+		attributes["PlatformPrincipal"] = pc.Principal
+	}
+
+	return nil
+}
+
+// Add SNS attribute map entries to request parameters, in key order.
+func encodeAttributeMap(params url.Values, attributes map[string]string) {
+
+	keys := make([]string, 0, len(attributes))
+	for key := range attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for ii, key := range keys {
+		prefix := "Attributes.entry." + strconv.Itoa(ii+1)
+		params.Set(prefix+".key", key)
+		params.Set(prefix+".value", attributes[key])
+	}
+}
+
+// Create an SNS platform application for sending push notifications
+// through a platform, returning its ARN. `attributes` holds optional
+// additional attributes (e.g. "EventEndpointCreated") and may be nil.
+func CreatePlatformApplication(c Context, host, name string, credentials PlatformCredentials, attributes map[string]string) (platformApplicationArn string, err error) {
+
+	all := make(map[string]string, len(attributes)+2)
+	for key, value := range attributes {
+		all[key] = value
+	}
+	if err := credentials.attributes(all); err != nil {
+		return "", err
+	}
+
+	params := make(url.Values)
+	params.Set("Name", name)
+	params.Set("Platform", credentials.Platform)
+	encodeAttributeMap(params, all)
+	params.Set("Action", "CreatePlatformApplication")
+
+	req, err := c.newPostRequest("https://"+host+"/", params)
+	if err != nil {
+		return "", err
+	}
+
+	var response struct {
+		CreatePlatformApplicationResult struct {
+			PlatformApplicationArn string
+		}
+	}
+
+	if err := c.call(req, &response); err != nil {
+		return "", err
+	}
+
+	return response.CreatePlatformApplicationResult.PlatformApplicationArn, nil
+}
+
+// Set attributes of a platform application. Use
+// SetPlatformApplicationCredentials to rotate its credentials.
+func SetPlatformApplicationAttributes(c Context, host, platformApplicationArn string, attributes map[string]string) error {
+
+	if len(attributes) == 0 {
+		return errors.New("No attributes to set")
+	}
+
+	params := make(url.Values)
+	params.Set("PlatformApplicationArn", platformApplicationArn)
+	encodeAttributeMap(params, attributes)
+	params.Set("Action", "SetPlatformApplicationAttributes")
+
+	req, err := c.newPostRequest("https://"+host+"/", params)
+	if err != nil {
+		return err
+	}
+
+	return c.call(req, nil)
+}
+
+// Replace the platform credentials of a platform application.
+func SetPlatformApplicationCredentials(c Context, host, platformApplicationArn string, credentials PlatformCredentials) error {
+
+	attributes := make(map[string]string, 2)
+	if err := credentials.attributes(attributes); err != nil {
+		return err
+	}
+
+	return SetPlatformApplicationAttributes(c, host, platformApplicationArn, attributes)
+}
+
+// Delete a platform application.
+func DeletePlatformApplication(c Context, host, platformApplicationArn string) error {
+
+	params := make(url.Values)
+	params.Set("PlatformApplicationArn", platformApplicationArn)
+	params.Set("Action", "DeletePlatformApplication")
+
+	req, err := http.NewRequest("GET", "https://"+host+"/?"+params.Encode(), nil)
+	if err != nil {
+		return errors.New("Failed to create request: " + err.Error())
+	}
+
+	if err := c.SignRequest(req); err != nil {
+		return err
+	}
+
+	return c.call(req, nil)
+}
@@ -0,0 +1,188 @@
+// Copyright 2012 Matthew Endsley
+// All rights reserved
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted providing that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+// STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+// IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package goaws
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Settings applied to a queue when it is created. Zero values use the
+// SQS defaults. Durations are sent as whole seconds.
+type QueueConfig struct {
+	// Time received messages are hidden from other consumers. Up to
+	// 12 hours; SQS defaults to 30 seconds.
+	VisibilityTimeout time.Duration
+
+	// Time new messages are hidden before their first delivery. Up to
+	// 15 minutes.
+	Delay time.Duration
+
+	// Time messages are kept before being deleted. Between 1 minute
+	// and 14 days; SQS defaults to 4 days.
+	MessageRetentionPeriod time.Duration
+
+	// Default long poll wait time of receives that don't specify one.
+	// Up to 20 seconds.
+	ReceiveWaitTime time.Duration
+
+	// Maximum message size in bytes. Between 1KB and 1MB.
+	MaximumMessageSize int
+
+	// Create a FIFO queue. The queue name must end in ".fifo".
+	FifoQueue bool
+
+	// Deduplicate FIFO messages by the SHA-256 of their body when no
+	// deduplication id is sent.
+	ContentBasedDeduplication bool
+}
+
+// Limits on queue attributes.
+const (
+	maxQueueDelay           = 15 * time.Minute
+	minQueueRetentionPeriod = time.Minute
+	maxQueueRetentionPeriod = 14 * 24 * time.Hour
+	minQueueMessageSize     = 1024
+	maxQueueMessageSize     = 1024 * 1024
+	maxVisibilityTimeout    = 12 * time.Hour
+)
+
+// Get the queue attributes for the configuration, validating each
+// against the SQS limits.
+func (config QueueConfig) attributes(name string) (map[string]string, error) {
+
+	seconds := func(d time.Duration) string {
+		return strconv.Itoa(int(d / time.Second))
+	}
+
+	attributes := make(map[string]string)
+	if d := config.VisibilityTimeout; d != 0 {
+		if d < 0 || d > maxVisibilityTimeout {
+			return nil, fmt.Errorf("%w: must be no longer than 12 hours. Got: %v", ErrVisibilityTimeoutRange, d)
+		}
+		attributes["VisibilityTimeout"] = seconds(d)
+	}
+
+	if d := config.Delay; d != 0 {
+		if d < 0 || d > maxQueueDelay {
+			return nil, fmt.Errorf("Delay must be no longer than 15 minutes. Got: %v", d)
+		}
+		attributes["DelaySeconds"] = seconds(d)
+	}
+
+	if d := config.MessageRetentionPeriod; d != 0 {
+		if d < minQueueRetentionPeriod || d > maxQueueRetentionPeriod {
+			return nil, fmt.Errorf("Message retention period must be between 1 minute and 14 days. Got: %v", d)
+		}
+		attributes["MessageRetentionPeriod"] = seconds(d)
+	}
+
+	if d := config.ReceiveWaitTime; d != 0 {
+		if d < 0 || d > maxLongPollWait {
+			return nil, fmt.Errorf("%w: must be no longer than 20 seconds. Got: %v", ErrWaitTimeRange, d)
+		}
+		attributes["ReceiveMessageWaitTimeSeconds"] = seconds(d)
+	}
+
+	if size := config.MaximumMessageSize; size != 0 {
+		if size < minQueueMessageSize || size > maxQueueMessageSize {
+			return nil, fmt.Errorf("Maximum message size must be between %d and %d bytes. Got: %d", minQueueMessageSize, maxQueueMessageSize, size)
+		}
+		attributes["MaximumMessageSize"] = strconv.Itoa(size)
+	}
+
+	if config.FifoQueue != strings.HasSuffix(name, ".fifo") {
+		return nil, errors.New("FIFO queue names must end in .fifo, and only FIFO queue names may: " + name)
+	}
+
+	if config.FifoQueue {
+		attributes["FifoQueue"] = "true"
+		if config.ContentBasedDeduplication {
+			attributes["ContentBasedDeduplication"] = "true"
+		}
+	} else if config.ContentBasedDeduplication {
+		return nil, errors.New("Content based deduplication is only supported by FIFO queues")
+	}
+
+	return attributes, nil
+}
+
+// Create a queue named `name` on the SQS endpoint (e.g.
+// "https://sqs.us-east-1.amazonaws.com"), applying `config` atomically
+// as part of the creation.
+//
+// If the queue already exists with the same attributes, the existing
+// queue is returned. If its attributes differ, the error wraps
+// ErrAttributesMismatch.
+func CreateQueue(c Context, endpoint, name string, config QueueConfig) (Queue, error) {
+
+	attributes, err := config.attributes(name)
+	if err != nil {
+		return Queue{}, err
+	}
+
+	params := make(url.Values)
+	params.Set("Action", "CreateQueue")
+	params.Set("Version", "2012-11-05")
+	params.Set("QueueName", name)
+
+	keys := make([]string, 0, len(attributes))
+	for key := range attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for ii, key := range keys {
+		prefix := "Attribute." + strconv.Itoa(ii+1)
+		params.Set(prefix+".Name", key)
+		params.Set(prefix+".Value", attributes[key])
+	}
+
+	req, err := c.newPostRequest(normalizeQueueURL(endpoint)+"/", params)
+	if err != nil {
+		return Queue{}, err
+	}
+
+	var response struct {
+		CreateQueueResult struct {
+			QueueUrl string
+		}
+	}
+
+	if err := c.call(req, &response); err != nil {
+		var awsErr *AWSError
+		if errors.As(err, &awsErr) && awsErr.Code == "QueueAlreadyExists" {
+			return Queue{}, fmt.Errorf("%w: queue %s: %w", ErrAttributesMismatch, name, err)
+		}
+		return Queue{}, err
+	}
+
+	return NewQueue(response.CreateQueueResult.QueueUrl), nil
+}
@@ -0,0 +1,134 @@
+// Copyright 2012 Matthew Endsley
+// All rights reserved
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted providing that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+// STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+// IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package goaws
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httputil"
+	"sync"
+)
+
+// A recorded HTTP exchange with an AWS service.
+type Exchange struct {
+	// The fully signed request, in HTTP/1.1 wire format.
+	Request []byte
+
+	// The complete response, including its body, in HTTP/1.1 wire
+	// format.
+	Response []byte
+}
+
+// An http.RoundTripper that records every exchange it carries. Set it
+// as a Context's Transport to capture real interactions, e.g. for
+// golden-file tests, and replay them later with a ReplayTransport.
+type RoundTripRecorder struct {
+	// Transport used to send requests. http.DefaultTransport if nil.
+	Transport http.RoundTripper
+
+	// Called with each exchange as it is recorded, if set.
+	OnExchange func(Exchange)
+
+	mu        sync.Mutex
+	exchanges []Exchange
+}
+
+func (rec *RoundTripRecorder) RoundTrip(r *http.Request) (*http.Response, error) {
+
+	request, err := httputil.DumpRequestOut(r, true)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := rec.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	resp, err := transport.RoundTrip(r)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := httputil.DumpResponse(resp, true)
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+
+	exchange := Exchange{Request: request, Response: response}
+	rec.mu.Lock()
+	rec.exchanges = append(rec.exchanges, exchange)
+	rec.mu.Unlock()
+
+	if rec.OnExchange != nil {
+		rec.OnExchange(exchange)
+	}
+
+	return resp, nil
+}
+
+// Get the exchanges recorded so far, in order.
+func (rec *RoundTripRecorder) Exchanges() []Exchange {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	return append([]Exchange(nil), rec.exchanges...)
+}
+
+// An http.RoundTripper that answers requests with previously recorded
+// responses, in the order they were recorded, without using the
+// network. Requests are not matched against the recorded requests,
+// since signatures and timestamps differ between runs.
+type ReplayTransport struct {
+	mu        sync.Mutex
+	exchanges []Exchange
+}
+
+// Create a transport replaying `exchanges`.
+func NewReplayTransport(exchanges []Exchange) *ReplayTransport {
+	return &ReplayTransport{
+		exchanges: append([]Exchange(nil), exchanges...),
+	}
+}
+
+func (rt *ReplayTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if r.Body != nil {
+		r.Body.Close()
+	}
+
+	rt.mu.Lock()
+	if len(rt.exchanges) == 0 {
+		rt.mu.Unlock()
+		return nil, errors.New("No recorded exchanges left to replay")
+	}
+	exchange := rt.exchanges[0]
+	rt.exchanges = rt.exchanges[1:]
+	rt.mu.Unlock()
+
+	return http.ReadResponse(bufio.NewReader(bytes.NewReader(exchange.Response)), r)
+}
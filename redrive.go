@@ -0,0 +1,159 @@
+// Copyright 2012 Matthew Endsley
+// All rights reserved
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted providing that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+// STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+// IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package goaws
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// Maximum rate, in messages per second, of a message move task.
+const MaxRedriveVelocity = 500
+
+// Get the service endpoint hosting the queue, for actions that don't
+// address a specific queue.
+func (q Queue) endpoint() (string, error) {
+	u, err := url.Parse(q.url)
+	if err != nil {
+		return "", errors.New("Malformed queue URL: " + err.Error())
+	}
+
+	return u.Scheme + "://" + u.Host + "/", nil
+}
+
+// Get the ARN of the queue.
+func (q Queue) arn(c Context) (string, error) {
+	attributes, err := q.GetAttributes(c, "QueueArn")
+	if err != nil {
+		return "", err
+	}
+
+	arn := attributes["QueueArn"]
+	if arn == "" {
+		return "", errors.New("Queue ARN not returned for " + q.url)
+	}
+
+	return arn, nil
+}
+
+// Start moving messages from a dead-letter queue back to `destination`.
+// If `destination` is the zero Queue, messages are moved back to the
+// queues they were originally sent to. `maxVelocity` limits the number
+// of messages moved per second (up to MaxRedriveVelocity); zero lets
+// SQS choose. Returns the handle of the started task, which can be
+// passed to CancelMessageMoveTask.
+func (dlq Queue) StartRedrive(c Context, destination Queue, maxVelocity int) (taskHandle string, err error) {
+
+	if maxVelocity < 0 || maxVelocity > MaxRedriveVelocity {
+		return "", fmt.Errorf("Max velocity must be between 0 and %d. Got: %d", MaxRedriveVelocity, maxVelocity)
+	}
+
+	sourceArn, err := dlq.arn(c)
+	if err != nil {
+		return "", err
+	}
+
+	params := make(url.Values)
+	params.Set("Action", "StartMessageMoveTask")
+	params.Set("Version", "2012-11-05")
+	params.Set("SourceArn", sourceArn)
+	if destination.url != "" {
+		destinationArn, err := destination.arn(c)
+		if err != nil {
+			return "", err
+		}
+
+		params.Set("DestinationArn", destinationArn)
+	}
+	if maxVelocity > 0 {
+		params.Set("MaxNumberOfMessagesPerSecond", strconv.Itoa(maxVelocity))
+	}
+
+	endpoint, err := dlq.endpoint()
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequest("GET", endpoint+"?"+params.Encode(), nil)
+	if err != nil {
+		return "", errors.New("Failed to create request: " + err.Error())
+	}
+
+	if err := c.SignRequest(req); err != nil {
+		return "", err
+	}
+
+	var response struct {
+		StartMessageMoveTaskResult struct {
+			TaskHandle string
+		}
+	}
+
+	if err := c.call(req, &response); err != nil {
+		return "", err
+	}
+
+	return response.StartMessageMoveTaskResult.TaskHandle, nil
+}
+
+// Cancel a message move task started by StartRedrive. Returns the
+// approximate number of messages moved before the task was cancelled.
+// Messages already moved are not moved back.
+func (q Queue) CancelMessageMoveTask(c Context, taskHandle string) (moved int64, err error) {
+
+	params := make(url.Values)
+	params.Set("Action", "CancelMessageMoveTask")
+	params.Set("Version", "2012-11-05")
+	params.Set("TaskHandle", taskHandle)
+
+	endpoint, err := q.endpoint()
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequest("GET", endpoint+"?"+params.Encode(), nil)
+	if err != nil {
+		return 0, errors.New("Failed to create request: " + err.Error())
+	}
+
+	if err := c.SignRequest(req); err != nil {
+		return 0, err
+	}
+
+	var response struct {
+		CancelMessageMoveTaskResult struct {
+			ApproximateNumberOfMessagesMoved int64
+		}
+	}
+
+	if err := c.call(req, &response); err != nil {
+		return 0, err
+	}
+
+	return response.CancelMessageMoveTaskResult.ApproximateNumberOfMessagesMoved, nil
+}
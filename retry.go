@@ -0,0 +1,318 @@
+// Copyright 2012 Matthew Endsley
+// All rights reserved
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted providing that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+// STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+// IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package goaws
+
+import (
+	crand "crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Details of a single attempt at sending a request, reported to a
+// Context's OnAttempt hook.
+type AttemptMetrics struct {
+	Method string
+	Host   string
+
+	// Client generated id shared by every attempt of the same
+	// operation.
+	CorrelationId string
+
+	// Request id assigned by Amazon to this attempt, if reported in
+	// the response headers.
+	RequestId string
+
+	// Attempt number, starting at 1.
+	Attempt int
+
+	// HTTP status of the response, or zero if no response was
+	// received.
+	StatusCode int
+
+	// Transport error, if any.
+	Err error
+
+	// Time taken to receive the response headers.
+	Duration time.Duration
+
+	// Breakdown of Duration into connection setup and time to first
+	// byte. Reading and decoding the response body happens after the
+	// hook is called, so it is not included.
+	Timings AttemptTimings
+
+	// Delay requested by the server through a Retry-After header.
+	ServerDelay time.Duration
+
+	// Set on the last attempt of an operation, whose result is
+	// returned to the caller.
+	Final bool
+}
+
+// Generate an id used to correlate the attempts of an operation.
+func newCorrelationId() string {
+	var b [16]byte
+	if _, err := crand.Read(b[:]); err != nil {
+		return ""
+	}
+
+	return hex.EncodeToString(b[:])
+}
+
+// Get the Amazon request id from a response's headers.
+func responseRequestId(resp *http.Response) string {
+	if resp == nil {
+		return ""
+	}
+
+	if id := resp.Header.Get("X-Amzn-Requestid"); id != "" {
+		return id
+	}
+
+	return resp.Header.Get("X-Amz-Request-Id")
+}
+
+// Strategy used to randomize retry delays.
+type JitterStrategy int
+
+const (
+	// Wait a random duration between zero and the computed delay.
+	JitterFull = JitterStrategy(iota)
+
+	// Wait half the computed delay plus a random duration up to the
+	// other half.
+	JitterEqual
+
+	// Wait exactly the computed delay.
+	JitterNone
+)
+
+// Default retry settings, matching the AWS SDK's standard retry mode.
+const (
+	DefaultRetryMaxAttempts = 3
+	DefaultRetryBaseDelay   = 100 * time.Millisecond
+	DefaultRetryMultiplier  = 2
+	DefaultRetryMaxDelay    = 20 * time.Second
+)
+
+// Controls how failed requests are retried. Requests are retried after
+// transport errors and throttling or server (5xx) responses. Zero
+// valued fields use the corresponding default.
+type RetryPolicy struct {
+	// Maximum number of attempts, including the first.
+	MaxAttempts int
+
+	// Delay before the first retry.
+	BaseDelay time.Duration
+
+	// Factor the delay grows by after each retry.
+	Multiplier float64
+
+	// Upper bound on the delay between attempts.
+	MaxDelay time.Duration
+
+	// Upper bound on the total time spent on a request, including
+	// retries. Zero means no bound beyond MaxAttempts.
+	MaxElapsed time.Duration
+
+	// How delays are randomized.
+	Jitter JitterStrategy
+}
+
+func (p *RetryPolicy) maxAttempts() int {
+	if p.MaxAttempts > 0 {
+		return p.MaxAttempts
+	}
+
+	return DefaultRetryMaxAttempts
+}
+
+// Get the delay before retry number `retry` (starting at zero).
+func (p *RetryPolicy) backoff(retry int) time.Duration {
+
+	base, multiplier, max := p.BaseDelay, p.Multiplier, p.MaxDelay
+	if base <= 0 {
+		base = DefaultRetryBaseDelay
+	}
+	if multiplier < 1 {
+		multiplier = DefaultRetryMultiplier
+	}
+	if max <= 0 {
+		max = DefaultRetryMaxDelay
+	}
+
+	delay := float64(base) * math.Pow(multiplier, float64(retry))
+	if delay > float64(max) {
+		delay = float64(max)
+	}
+
+	switch p.Jitter {
+	case JitterFull:
+		delay = rand.Float64() * delay
+	case JitterEqual:
+		delay = delay/2 + rand.Float64()*delay/2
+	}
+
+	return time.Duration(delay)
+}
+
+// Should a request be retried given the result of an attempt?
+func shouldRetry(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	}
+
+	return false
+}
+
+// Get the delay requested by a Retry-After header, in either its
+// delay-seconds or HTTP-date form. Returns zero if the header is
+// missing or malformed.
+func retryAfter(resp *http.Response) time.Duration {
+
+	if resp == nil {
+		return 0
+	}
+
+	header := resp.Header.Get("Retry-After")
+	if header == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(header); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+
+	if t, err := http.ParseTime(header); err == nil {
+		if delay := time.Until(t); delay > 0 {
+			return delay
+		}
+	}
+
+	return 0
+}
+
+// Policy used when a Context has no retry policy.
+var noRetryPolicy = RetryPolicy{MaxAttempts: 1}
+
+// Send a request with `client`, retrying according to the policy and
+// reporting each attempt to the context's OnAttempt hook.
+func (c Context) retry(client *http.Client, r *http.Request, p *RetryPolicy) (*http.Response, error) {
+
+	var correlationId string
+	if c.OnAttempt != nil {
+		correlationId = newCorrelationId()
+	}
+
+	start := time.Now()
+	for retry := 0; ; retry++ {
+		attemptStart := time.Now()
+		var resp *http.Response
+		var err error
+		var trace *attemptTrace
+		if c.OnAttempt != nil {
+			var traced *http.Request
+			trace, traced = newAttemptTrace(r)
+			resp, err = client.Do(traced)
+		} else {
+			resp, err = client.Do(r)
+		}
+
+		metrics := AttemptMetrics{
+			Method:        r.Method,
+			Host:          r.URL.Host,
+			CorrelationId: correlationId,
+			RequestId:     responseRequestId(resp),
+			Attempt:       retry + 1,
+			Err:           err,
+			Duration:      time.Since(attemptStart),
+			ServerDelay:   retryAfter(resp),
+		}
+		if resp != nil {
+			metrics.StatusCode = resp.StatusCode
+		}
+
+		// Honor the server's requested delay if it is longer
+		delay := p.backoff(retry)
+		if metrics.ServerDelay > delay {
+			delay = metrics.ServerDelay
+		}
+
+		// Requests with a body can only be resent if it can be re-read
+		metrics.Final = !shouldRetry(resp, err) ||
+			retry+1 >= p.maxAttempts() ||
+			(r.Body != nil && r.GetBody == nil) ||
+			(p.MaxElapsed > 0 && time.Since(start)+delay > p.MaxElapsed)
+
+		if c.OnAttempt != nil {
+			metrics.Timings = trace.result()
+			c.OnAttempt(metrics)
+		}
+
+		if metrics.Final {
+			return resp, err
+		}
+
+		lastErr := err
+		if resp != nil {
+			lastErr = errors.New("Amazon returned " + resp.Status)
+			closeBody(resp)
+		}
+
+		// Stop waiting if the request's context ends during the backoff
+		timer := time.NewTimer(delay)
+		select {
+		case <-r.Context().Done():
+			timer.Stop()
+			return nil, fmt.Errorf("%w (last attempt: %w)", r.Context().Err(), lastErr)
+		case <-timer.C:
+		}
+
+		if r.GetBody != nil {
+			body, err := r.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			r.Body = body
+		}
+	}
+}
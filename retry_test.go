@@ -0,0 +1,182 @@
+// Copyright 2012 Matthew Endsley
+// All rights reserved
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted providing that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+// STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+// IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package goaws
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRetryBackoff(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		policy RetryPolicy
+
+		// Bounds of the delay before each retry.
+		min, max []time.Duration
+	}{
+		{
+			name:   "defaults",
+			policy: RetryPolicy{Jitter: JitterNone},
+			min:    []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond},
+			max:    []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond},
+		},
+		{
+			name:   "capped",
+			policy: RetryPolicy{BaseDelay: time.Second, Multiplier: 3, MaxDelay: 5 * time.Second, Jitter: JitterNone},
+			min:    []time.Duration{time.Second, 3 * time.Second, 5 * time.Second, 5 * time.Second},
+			max:    []time.Duration{time.Second, 3 * time.Second, 5 * time.Second, 5 * time.Second},
+		},
+		{
+			name:   "full jitter",
+			policy: RetryPolicy{BaseDelay: time.Second, MaxDelay: 3 * time.Second, Jitter: JitterFull},
+			min:    []time.Duration{0, 0, 0, 0},
+			max:    []time.Duration{time.Second, 2 * time.Second, 3 * time.Second, 3 * time.Second},
+		},
+		{
+			name:   "equal jitter",
+			policy: RetryPolicy{BaseDelay: time.Second, MaxDelay: 3 * time.Second, Jitter: JitterEqual},
+			min:    []time.Duration{time.Second / 2, time.Second, 3 * time.Second / 2, 3 * time.Second / 2},
+			max:    []time.Duration{time.Second, 2 * time.Second, 3 * time.Second, 3 * time.Second},
+		},
+	}
+
+	for _, tt := range tests {
+		for retry := range tt.min {
+			seen := make(map[time.Duration]bool)
+			for ii := 0; ii < 100; ii++ {
+				delay := tt.policy.backoff(retry)
+				if delay < tt.min[retry] || delay > tt.max[retry] {
+					t.Errorf("%s: retry %d: delay %v outside [%v, %v]", tt.name, retry, delay, tt.min[retry], tt.max[retry])
+				}
+				seen[delay] = true
+			}
+
+			// jittered delays must vary
+			if jittered := tt.policy.Jitter != JitterNone; jittered != (len(seen) > 1) {
+				t.Errorf("%s: retry %d: %d distinct delays", tt.name, retry, len(seen))
+			}
+		}
+	}
+}
+
+// Create a context whose requests all fail with 503, counting attempts.
+func newUnavailableContext(attempts *int) Context {
+	c := NewContext("id", "key")
+	c.Transport = roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		*attempts++
+		return &http.Response{
+			StatusCode: http.StatusServiceUnavailable,
+			Status:     "503 Service Unavailable",
+			Body:       io.NopCloser(strings.NewReader("")),
+			Request:    r,
+		}, nil
+	})
+
+	return c
+}
+
+func TestRetryMaxElapsed(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		policy   RetryPolicy
+		attempts int
+	}{
+		{"max attempts", RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, Jitter: JitterNone}, 3},
+		{"max elapsed", RetryPolicy{MaxAttempts: 10, BaseDelay: 20 * time.Millisecond, MaxElapsed: 50 * time.Millisecond, Jitter: JitterNone}, 2},
+	}
+
+	for _, tt := range tests {
+		attempts := 0
+		c := newUnavailableContext(&attempts)
+		c.Retry = &tt.policy
+
+		req, err := http.NewRequest("GET", "https://sqs.us-east-1.amazonaws.com/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp, err := c.do(req, 0)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+		} else {
+			closeBody(resp)
+		}
+		if attempts != tt.attempts {
+			t.Errorf("%s: made %d attempts, want %d", tt.name, attempts, tt.attempts)
+		}
+	}
+}
+
+func TestRetryBackoffCancelled(t *testing.T) {
+
+	tests := []struct {
+		name string
+		ctx  func() (context.Context, context.CancelFunc)
+		err  error
+	}{
+		{"cancelled", func() (context.Context, context.CancelFunc) {
+			ctx, cancel := context.WithCancel(context.Background())
+			time.AfterFunc(50*time.Millisecond, cancel)
+			return ctx, cancel
+		}, context.Canceled},
+		{"deadline", func() (context.Context, context.CancelFunc) {
+			return context.WithTimeout(context.Background(), 50*time.Millisecond)
+		}, context.DeadlineExceeded},
+	}
+
+	for _, tt := range tests {
+		attempts := 0
+		c := newUnavailableContext(&attempts)
+		c.Retry = &RetryPolicy{MaxAttempts: 5, BaseDelay: 10 * time.Second, Jitter: JitterNone}
+		ctx, cancel := tt.ctx()
+		c = c.WithContext(ctx)
+
+		req, err := http.NewRequest("GET", "https://sqs.us-east-1.amazonaws.com/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		start := time.Now()
+		_, err = c.do(req, 0)
+		cancel()
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("%s: returned after %v", tt.name, elapsed)
+		}
+		if !errors.Is(err, tt.err) || !strings.Contains(err.Error(), "503") {
+			t.Errorf("%s: error = %v, want %v wrapping the last attempt", tt.name, err, tt.err)
+		}
+		if attempts != 1 {
+			t.Errorf("%s: made %d attempts, want 1", tt.name, attempts)
+		}
+	}
+}
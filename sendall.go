@@ -0,0 +1,106 @@
+// Copyright 2012 Matthew Endsley
+// All rights reserved
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted providing that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+// STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+// IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package goaws
+
+import (
+	"context"
+	"sync"
+)
+
+// Send messages with the given bodies to the queue, in batches of up to
+// 10 messages with at most `concurrency` batches in flight. Returns a
+// map of body index to error for each message that could not be sent.
+//
+// If `ctx` is cancelled, no further batches are sent, messages that
+// were not sent are reported as failed with the context's error, and
+// the context's error is also returned.
+func (q Queue) SendAll(ctx context.Context, c Context, bodies []string, concurrency int) (failed map[int]error, err error) {
+
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	batches := make(chan int)
+	var mu sync.Mutex
+	fail := func(ii int, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if failed == nil {
+			failed = make(map[int]error)
+		}
+		failed[ii] = err
+	}
+
+	var wg sync.WaitGroup
+	for ii := 0; ii < concurrency; ii++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for start := range batches {
+				end := start + maxBatchEntries
+				if end > len(bodies) {
+					end = len(bodies)
+				}
+
+				msgs := make([]SendMessageInput, end-start)
+				for jj := range msgs {
+					msgs[jj].Body = bodies[start+jj]
+				}
+
+				_, errs, err := q.sendBatch(ctx, c, msgs)
+				for jj := range msgs {
+					if err != nil {
+						fail(start+jj, err)
+					} else if errs[jj] != nil {
+						fail(start+jj, errs[jj])
+					}
+				}
+			}
+		}()
+	}
+
+	start := 0
+dispatch:
+	for ; start < len(bodies); start += maxBatchEntries {
+		select {
+		case batches <- start:
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+
+	close(batches)
+	wg.Wait()
+
+	if start < len(bodies) {
+		for ii := start; ii < len(bodies); ii++ {
+			fail(ii, ctx.Err())
+		}
+		return failed, ctx.Err()
+	}
+
+	return failed, nil
+}
@@ -0,0 +1,310 @@
+// Copyright 2012 Matthew Endsley
+// All rights reserved
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted providing that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+// STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+// IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package goaws
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Maximum lifetime of a SignatureVersion 4 pre-signed URL.
+const maxPresignExpiry = 7 * 24 * time.Hour
+
+// Get the region and service for an AWS endpoint host.
+func hostRegionService(host string) (region, service string, err error) {
+
+	host = (&url.URL{Host: host}).Hostname()
+	labels := strings.Split(host, ".")
+	switch {
+	case host == "queue.amazonaws.com":
+		return "us-east-1", "sqs", nil
+
+	case len(labels) == 4 && labels[1] == "queue" && strings.HasSuffix(host, ".amazonaws.com"):
+		// legacy SQS endpoint: <region>.queue.amazonaws.com
+		return labels[0], "sqs", nil
+
+	case len(labels) >= 4 && strings.HasSuffix(host, ".amazonaws.com"),
+		len(labels) >= 5 && strings.HasSuffix(host, ".amazonaws.com.cn"),
+		len(labels) >= 4 && strings.HasSuffix(host, ".api.aws"),
+		len(labels) >= 6 && strings.HasSuffix(host, ".api.amazonwebservices.com.cn"):
+		// <service>.<region>.amazonaws.com[.cn], or dualstack
+		// <service>.<region>.api.aws
+		return labels[1], labels[0], nil
+	}
+
+	return "", "", errors.New("Cannot determine region and service for host: " + host)
+}
+
+// Compute HMAC-SHA256 of `data` using `key`.
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// Create a pre-signed URL for a request using SignatureVersion 4 query
+// string signing. The URL is valid for `expiry`, which must be between
+// one second and seven days. The region and service are derived from
+// the request's host, before any endpoint override (see WithEndpoint)
+// is applied. The request itself is not modified.
+//
+// The host header is always signed. `signedHeaders` names additional
+// headers of the request to sign; whoever uses the URL must then send
+// them with the same values.
+func (c Context) PresignV4(r *http.Request, expiry time.Duration, signedHeaders ...string) (string, error) {
+
+	if expiry < time.Second || expiry > maxPresignExpiry {
+		return "", errors.New("Pre-signed URL expiry must be between 1 second and 7 days. Got: " + expiry.String())
+	}
+
+	c, err := c.resolveCredentials()
+	if err != nil {
+		return "", err
+	}
+
+	region, service, err := hostRegionService(r.URL.Host)
+	if err != nil {
+		return "", err
+	}
+
+	if c.rewritesURLs() {
+		r = r.Clone(r.Context())
+		if err := c.rewriteURL(r.URL); err != nil {
+			return "", err
+		}
+		r.Host = r.URL.Host
+	}
+
+	now := time.Now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+
+	headers, signed := v4CanonicalHeaders(r, append([]string{"host"}, signedHeaders...))
+
+	params := r.URL.Query()
+	params.Set("X-Amz-Algorithm", "AWS4-HMAC-SHA256")
+	params.Set("X-Amz-Credential", c.keyId+"/"+scope)
+	params.Set("X-Amz-Date", amzDate)
+	params.Set("X-Amz-Expires", strconv.Itoa(int(expiry.Seconds())))
+	params.Set("X-Amz-SignedHeaders", signed)
+	if c.token != "" {
+		params.Set("X-Amz-Security-Token", c.token)
+	}
+
+	queryString := v4CanonicalQuery(params)
+	payloadHash := sha256.Sum256(nil)
+	canonicalRequest := strings.Join([]string{
+		r.Method,
+		v4CanonicalPath(r.URL),
+		queryString,
+		headers,
+		signed,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+
+	signature := c.v4Signature(region, service, amzDate, canonicalRequest)
+
+	u := *r.URL
+	u.RawQuery = queryString + "&X-Amz-Signature=" + signature
+	return u.String(), nil
+}
+
+// Sign a request using SignatureVersion 4, adding the X-Amz-Date,
+// X-Amz-Security-Token (for temporary credentials) and Authorization
+// headers. The region and service are derived from the request's host,
+// before any endpoint override (see WithEndpoint) is applied.
+//
+// The host and x-amz-date headers, the security token, and the
+// content-type of requests with a body are always signed.
+// `signedHeaders` names additional headers of the request to sign,
+// such as x-amz-* headers required by an integration. The request body
+// is read to compute its hash, and replaced so it can still be sent.
+func (c Context) SignRequestV4(r *http.Request, signedHeaders ...string) error {
+
+	c, err := c.resolveCredentials()
+	if err != nil {
+		return err
+	}
+
+	region, service, err := hostRegionService(r.URL.Host)
+	if err != nil {
+		return err
+	}
+
+	if c.rewritesURLs() {
+		if err := c.rewriteURL(r.URL); err != nil {
+			return err
+		}
+		r.Host = r.URL.Host
+	}
+
+	var body []byte
+	if r.Body != nil {
+		body, err = io.ReadAll(r.Body)
+		r.Body.Close()
+		if err != nil {
+			return errors.New("Failed to read request body: " + err.Error())
+		}
+
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		r.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(body)), nil
+		}
+	}
+
+	now := time.Now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+
+	r.Header.Set("X-Amz-Date", amzDate)
+	names := append([]string{"host", "x-amz-date"}, signedHeaders...)
+	if c.token != "" {
+		r.Header.Set("X-Amz-Security-Token", c.token)
+		names = append(names, "x-amz-security-token")
+	}
+	if r.Header.Get("Content-Type") != "" && (r.Method == "POST" || len(body) > 0) {
+		names = append(names, "content-type")
+	}
+
+	headers, signed := v4CanonicalHeaders(r, names)
+	payloadHash := sha256.Sum256(body)
+	canonicalRequest := strings.Join([]string{
+		r.Method,
+		v4CanonicalPath(r.URL),
+		v4CanonicalQuery(r.URL.Query()),
+		headers,
+		signed,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+
+	signature := c.v4Signature(region, service, amzDate, canonicalRequest)
+	r.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+c.keyId+"/"+scope+", SignedHeaders="+signed+", Signature="+signature)
+	return nil
+}
+
+// Build the SignatureVersion 4 canonical query string. Keys and values
+// are URI-encoded first, then sorted by encoded key and encoded value,
+// as the ordering can differ from that of the raw strings.
+func v4CanonicalQuery(params url.Values) string {
+
+	encoded := make(map[string][]string, len(params))
+	keys := make([]string, 0, len(params))
+	for key, values := range params {
+		key = awsEncode(key)
+		keys = append(keys, key)
+		for _, value := range values {
+			encoded[key] = append(encoded[key], awsEncode(value))
+		}
+	}
+	sort.Strings(keys)
+
+	var query []string
+	for _, key := range keys {
+		values := encoded[key]
+		sort.Strings(values)
+		for _, value := range values {
+			query = append(query, key+"="+value)
+		}
+	}
+
+	return strings.Join(query, "&")
+}
+
+// Get the SignatureVersion 4 canonical path of a URL.
+func v4CanonicalPath(u *url.URL) string {
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+
+	return path
+}
+
+// Build the SignatureVersion 4 canonical header block for the named
+// headers of a request, and the matching signed headers list. Names
+// are lowercased, deduplicated and sorted. The host is taken from the
+// request URL.
+func v4CanonicalHeaders(r *http.Request, names []string) (headers, signed string) {
+
+	seen := make(map[string]bool, len(names))
+	var sorted []string
+	for _, name := range names {
+		name = strings.ToLower(name)
+		if !seen[name] {
+			seen[name] = true
+			sorted = append(sorted, name)
+		}
+	}
+	sort.Strings(sorted)
+
+	var block strings.Builder
+	for _, name := range sorted {
+		var value string
+		if name == "host" {
+			value = canonicalHost(r.URL)
+		} else {
+			var values []string
+			for _, v := range r.Header.Values(name) {
+				values = append(values, strings.Join(strings.Fields(v), " "))
+			}
+			value = strings.Join(values, ",")
+		}
+
+		block.WriteString(name + ":" + value + "\n")
+	}
+
+	return block.String(), strings.Join(sorted, ";")
+}
+
+// Compute the SignatureVersion 4 signature of a canonical request.
+func (c Context) v4Signature(region, service, amzDate, canonicalRequest string) string {
+
+	date := amzDate[:8]
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		date + "/" + region + "/" + service + "/aws4_request",
+		hex.EncodeToString(requestHash[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+c.key), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
@@ -0,0 +1,227 @@
+// Copyright 2012 Matthew Endsley
+// All rights reserved
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted providing that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+// STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+// IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package goaws
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestV4CanonicalQuery(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		params url.Values
+		want   string
+	}{
+		{"sorted by key", url.Values{"b": {"1"}, "a": {"2"}}, "a=2&b=1"},
+		{"repeated key", url.Values{"a": {"2", "1"}}, "a=1&a=2"},
+		{"space", url.Values{"a b": {"c d"}}, "a%20b=c%20d"},
+
+		// '{' sorts after 'z', but its encoding sorts before it
+		{"key order changed by encoding", url.Values{"az": {"1"}, "a{": {"2"}}, "a%7B=2&az=1"},
+		{"value order changed by encoding", url.Values{"a": {"z", "{"}}, "a=%7B&a=z"},
+		{"multibyte key", url.Values{"az": {"1"}, "aé": {"2"}}, "a%C3%A9=2&az=1"},
+	}
+
+	for _, tt := range tests {
+		if got := v4CanonicalQuery(tt.params); got != tt.want {
+			t.Errorf("%s: v4CanonicalQuery = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestV4CanonicalHeaders(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		rawURL  string
+		headers http.Header
+		names   []string
+		block   string
+		signed  string
+	}{
+		{
+			name:   "host only",
+			rawURL: "https://sqs.us-east-1.amazonaws.com/",
+			names:  []string{"host"},
+			block:  "host:sqs.us-east-1.amazonaws.com\n",
+			signed: "host",
+		},
+		{
+			name:    "sorted and lowercased",
+			rawURL:  "https://sqs.us-east-1.amazonaws.com:443/",
+			headers: http.Header{"X-Amz-Date": {"20240101T000000Z"}, "Content-Type": {"application/x-www-form-urlencoded"}},
+			names:   []string{"host", "X-Amz-Date", "Content-Type"},
+			block:   "content-type:application/x-www-form-urlencoded\nhost:sqs.us-east-1.amazonaws.com\nx-amz-date:20240101T000000Z\n",
+			signed:  "content-type;host;x-amz-date",
+		},
+		{
+			name:    "duplicate names",
+			rawURL:  "https://sqs.us-east-1.amazonaws.com/",
+			headers: http.Header{"X-Amz-Meta": {"a"}},
+			names:   []string{"host", "x-amz-meta", "X-Amz-Meta", "host"},
+			block:   "host:sqs.us-east-1.amazonaws.com\nx-amz-meta:a\n",
+			signed:  "host;x-amz-meta",
+		},
+		{
+			name:    "values trimmed and joined",
+			rawURL:  "http://localhost:4566/",
+			headers: http.Header{"X-Amz-Meta": {"  a   b ", "c"}},
+			names:   []string{"host", "x-amz-meta"},
+			block:   "host:localhost:4566\nx-amz-meta:a b,c\n",
+			signed:  "host;x-amz-meta",
+		},
+	}
+
+	for _, tt := range tests {
+		req, err := http.NewRequest("GET", tt.rawURL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for name, values := range tt.headers {
+			req.Header[name] = values
+		}
+
+		block, signed := v4CanonicalHeaders(req, tt.names)
+		if block != tt.block {
+			t.Errorf("%s: header block = %q, want %q", tt.name, block, tt.block)
+		}
+		if signed != tt.signed {
+			t.Errorf("%s: signed headers = %q, want %q", tt.name, signed, tt.signed)
+		}
+	}
+}
+
+func TestSignRequestV4SignedHeaders(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		method  string
+		body    string
+		headers http.Header
+		token   string
+		extra   []string
+		signed  string
+	}{
+		{"GET", "GET", "", nil, "", nil, "host;x-amz-date"},
+		{"POST", "POST", "Action=ListQueues", http.Header{"Content-Type": {"application/x-www-form-urlencoded"}}, "", nil, "content-type;host;x-amz-date"},
+		{"GET with content type", "GET", "", http.Header{"Content-Type": {"text/plain"}}, "", nil, "host;x-amz-date"},
+		{"temporary credentials", "GET", "", nil, "token", nil, "host;x-amz-date;x-amz-security-token"},
+		{"extra headers", "GET", "", http.Header{"X-Amz-Target": {"AmazonSQS.ListQueues"}}, "", []string{"X-Amz-Target"}, "host;x-amz-date;x-amz-target"},
+	}
+
+	for _, tt := range tests {
+		req, err := http.NewRequest(tt.method, "https://sqs.us-east-1.amazonaws.com/", strings.NewReader(tt.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for name, values := range tt.headers {
+			req.Header[name] = values
+		}
+
+		c := NewContext("id", "key").WithCredentials("id", "key", tt.token)
+		if err := c.SignRequestV4(req, tt.extra...); err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+			continue
+		}
+
+		auth := req.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=id/") || !strings.Contains(auth, "/us-east-1/sqs/aws4_request,") {
+			t.Errorf("%s: Authorization = %q", tt.name, auth)
+		}
+		if !strings.Contains(auth, " SignedHeaders="+tt.signed+", ") {
+			t.Errorf("%s: Authorization = %q, want SignedHeaders=%s", tt.name, auth, tt.signed)
+		}
+		if req.Header.Get("X-Amz-Date") == "" {
+			t.Errorf("%s: X-Amz-Date not set", tt.name)
+		}
+		if tt.token != "" && req.Header.Get("X-Amz-Security-Token") != tt.token {
+			t.Errorf("%s: X-Amz-Security-Token = %q", tt.name, req.Header.Get("X-Amz-Security-Token"))
+		}
+	}
+}
+
+func TestHostRegionService(t *testing.T) {
+
+	tests := []struct {
+		host    string
+		region  string
+		service string
+		err     bool
+	}{
+		{"sqs.us-east-1.amazonaws.com", "us-east-1", "sqs", false},
+		{"sqs.us-east-1.amazonaws.com:443", "us-east-1", "sqs", false},
+		{"sns.cn-north-1.amazonaws.com.cn", "cn-north-1", "sns", false},
+		{"queue.amazonaws.com", "us-east-1", "sqs", false},
+		{"eu-west-1.queue.amazonaws.com", "eu-west-1", "sqs", false},
+		{"sqs.us-east-1.api.aws", "us-east-1", "sqs", false},
+		{"sns.eu-west-1.api.aws", "eu-west-1", "sns", false},
+		{"sqs.cn-north-1.api.amazonwebservices.com.cn", "cn-north-1", "sqs", false},
+		{"localhost:4566", "", "", true},
+		{"api.aws", "", "", true},
+		{"example.com", "", "", true},
+	}
+
+	for _, tt := range tests {
+		region, service, err := hostRegionService(tt.host)
+		if tt.err {
+			if err == nil {
+				t.Errorf("%s: accepted as %s/%s", tt.host, region, service)
+			}
+		} else if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.host, err)
+		} else if region != tt.region || service != tt.service {
+			t.Errorf("%s: region %q, service %q, want %q, %q", tt.host, region, service, tt.region, tt.service)
+		}
+	}
+}
+
+func TestSignRequestV4Dualstack(t *testing.T) {
+
+	tests := []struct {
+		rawURL string
+		scope  string
+	}{
+		{"https://sqs.us-east-1.api.aws/123456789012/queue", "/us-east-1/sqs/aws4_request"},
+		{"https://sns.eu-west-1.api.aws/", "/eu-west-1/sns/aws4_request"},
+		{"https://sqs.cn-north-1.api.amazonwebservices.com.cn/", "/cn-north-1/sqs/aws4_request"},
+	}
+
+	for _, tt := range tests {
+		req, err := http.NewRequest("GET", tt.rawURL+"?Action=GetQueueAttributes", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := NewContext("id", "key").SignRequestV4(req); err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.rawURL, err)
+		} else if auth := req.Header.Get("Authorization"); !strings.Contains(auth, tt.scope+",") {
+			t.Errorf("%s: Authorization = %q, want scope %s", tt.rawURL, auth, tt.scope)
+		}
+	}
+}
@@ -25,36 +25,85 @@
 package goaws
 
 import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha1"
+	"encoding/base64"
 	"encoding/xml"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/url"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 )
 
 // Context for store-wide settings
 type Store struct {
 	Sandbox   bool
 	ReturnURL string
+
+	// FPS API version used for requests. Defaults to
+	// DefaultFPSVersion when empty.
+	APIVersion string
+}
+
+// Default FPS API version.
+const DefaultFPSVersion = "2008-09-17"
+
+// Get the FPS API version for requests.
+func (store Store) apiVersion() string {
+	if store.APIVersion != "" {
+		return store.APIVersion
+	}
+
+	return DefaultFPSVersion
 }
 
 // Defines a purchasable item.
 type Purchase struct {
 	Description string
-	Price       string
+
+	// Price of the item. If Amount is not set, Price is parsed as an
+	// amount (e.g. "USD 12.34").
+	Amount Money
+	Price  string
+
+	// Opaque caller data included in the signed purchase URL. Amazon
+	// echoes it back as `referenceId` on both the return redirect and
+	// the IPN, so it can carry state (e.g. an order id or a CSRF
+	// token bound to the session) used to correlate the callback with
+	// the originating request. At most 128 characters.
 	ReferenceId string
 }
 
+// Maximum length of a purchase reference id.
+const maxReferenceIdLength = 128
+
 // Create a URL to purchase an item.
 func (store Store) CreatePurchaseURL(c Context, item Purchase) (string, error) {
 
-	if !strings.HasPrefix(item.Price, "USD ") {
+	amount := item.Amount
+	if amount.Currency == "" {
+		var err error
+		if amount, err = ParseMoney(item.Price); err != nil {
+			return "", err
+		}
+	}
+
+	if amount.Currency != "USD" {
 		return "", errors.New("AWS only supports USD prices")
 	}
 
+	if len(item.ReferenceId) > maxReferenceIdLength {
+		return "", fmt.Errorf("Reference id must be no longer than %d characters. Got: %d", maxReferenceIdLength, len(item.ReferenceId))
+	}
+
 	params := make(url.Values)
 	params.Set("description", item.Description)
-	params.Set("amount", item.Price)
+	params.Set("amount", amount.String())
 	params.Set("cobrandingStyle", "logo")
 	params.Set("immediateReturn", "1")
 	params.Set("processImmediate", "0")
@@ -73,7 +122,9 @@ func (store Store) CreatePurchaseURL(c Context, item Purchase) (string, error) {
 		return "", errors.New("Failed to build request: " + err.Error())
 	}
 
-	c.sign(purchaseSigningContext, req)
+	if err := c.sign(purchaseSigningContext, req); err != nil {
+		return "", err
+	}
 
 	return req.URL.String(), nil
 }
@@ -81,27 +132,26 @@ func (store Store) CreatePurchaseURL(c Context, item Purchase) (string, error) {
 // Get the status of a transaction by id
 func (store Store) GetTransactionStatus(c Context, transactionId string) error {
 
-	params := make(url.Values)
-	params.Set("Action", "GetTransactionStatus")
-	params.Set("TransactionId", transactionId)
-	params.Set("Version", "2008-09-17")
-
-	host := "https://fps.amazonaws.com/?"
-	if store.Sandbox {
-		host = "https://fps.sandbox.amazonaws.com/?"
+	status, message, err := store.TransactionStatus(c, transactionId)
+	if err != nil {
+		return err
 	}
 
-	req, err := http.NewRequest("GET", host+params.Encode(), nil)
-	if err != nil {
-		return errors.New("Failed to build request: " + err.Error())
+	if status != "Success" {
+		return errors.New("Amazon returned an invalid status: (" + status + ") " + message)
 	}
 
-	c.SignRequest(req)
+	return nil
+}
 
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return errors.New("Failed to contact Amazon: " + err.Error())
-	}
+// Get the status code (e.g. "Success", "ReserveSuccessful" or
+// "PendingNetworkResponse") and status message of a transaction by id.
+// Errors are only returned when the status cannot be retrieved.
+func (store Store) TransactionStatus(c Context, transactionId string) (status, statusMessage string, err error) {
+
+	params := make(url.Values)
+	params.Set("Action", "GetTransactionStatus")
+	params.Set("TransactionId", transactionId)
 
 	var response struct {
 		GetTransactionStatusResult struct {
@@ -110,76 +160,177 @@ func (store Store) GetTransactionStatus(c Context, transactionId string) error {
 			StatusCode        string
 			StatusMessage     string
 		}
+		fpsErrorResponse
 	}
 
-	err = xml.NewDecoder(resp.Body).Decode(&response)
-	resp.Body.Close()
-	if err != nil {
-		return errors.New("Failed to parse Amazon response: " + err.Error())
+	if err := store.call(c, params, &response); err != nil {
+		return "", "", err
 	}
 
-	if response.GetTransactionStatusResult.StatusCode != "Success" {
-		return errors.New("Amazon returned an invalid status: (" + response.GetTransactionStatusResult.StatusCode + ") " + response.GetTransactionStatusResult.StatusMessage)
+	result := response.GetTransactionStatusResult
+	return result.StatusCode, result.StatusMessage, nil
+}
+
+// Maximum number of concurrent lookups made by GetTransactionStatuses.
+const maxConcurrentStatusLookups = 8
+
+// Get the status codes of several transactions, as returned by
+// TransactionStatus, keyed by transaction id. FPS has no batch status
+// lookup, so the transactions are looked up concurrently. Lookups that
+// fail are left out of the map, and their errors (each naming its
+// transaction) are joined into the returned error.
+func (store Store) GetTransactionStatuses(c Context, transactionIds []string) (map[string]string, error) {
+
+	type lookup struct {
+		id     string
+		status string
+		err    error
 	}
 
-	return nil
+	ids := make(chan string)
+	results := make(chan lookup)
+	workers := maxConcurrentStatusLookups
+	if len(transactionIds) < workers {
+		workers = len(transactionIds)
+	}
+
+	var wg sync.WaitGroup
+	for ii := 0; ii < workers; ii++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for id := range ids {
+				status, _, err := store.TransactionStatus(c, id)
+				results <- lookup{id: id, status: status, err: err}
+			}
+		}()
+	}
+
+	go func() {
+		for _, id := range transactionIds {
+			ids <- id
+		}
+		close(ids)
+		wg.Wait()
+		close(results)
+	}()
+
+	var statuses map[string]string
+	var errs []error
+	for result := range results {
+		if result.err != nil {
+			errs = append(errs, fmt.Errorf("Transaction %s: %w", result.id, result.err))
+			continue
+		}
+
+		if statuses == nil {
+			statuses = make(map[string]string)
+		}
+		statuses[result.id] = result.status
+	}
+
+	return statuses, errors.Join(errs...)
 }
 
-// Settle a transaction that has been reserved
+// Settle a transaction that has been reserved. The amount is parsed as
+// by ParseMoney.
 func (store Store) SettleTransaction(c Context, transactionId, amount string) error {
 
-	if !strings.HasPrefix(amount, "USD ") {
+	m, err := ParseMoney(amount)
+	if err != nil {
+		return err
+	}
+
+	return store.Settle(c, transactionId, m)
+}
+
+// Settle a transaction that has been reserved
+func (store Store) Settle(c Context, transactionId string, amount Money) error {
+
+	if amount.Currency != "USD" {
 		return errors.New("Cannot settle a non-USD transaction")
 	}
+	if amount.Amount <= 0 {
+		return errors.New("Cannot settle a non-positive amount: " + amount.String())
+	}
 
 	params := make(url.Values)
 	params.Set("Action", "Settle")
 	params.Set("ReserveTransactionId", transactionId)
 	params.Set("TransactionAmount.CurrencyCode", "USD")
-	params.Set("TransactionAmount.Value", amount[4:])
-	params.Set("Version", "2008-09-17")
+	params.Set("TransactionAmount.Value", amount.Value())
 
-	host := "https://fps.amazonaws.com/?"
-	if store.Sandbox {
-		host = "https://fps.sandbox.amazonaws.com/?"
+	var response struct {
+		SettleResult struct {
+			TransactionId     string
+			TransactionStatus string
+		}
+		fpsErrorResponse
 	}
 
-	req, err := http.NewRequest("GET", host+params.Encode(), nil)
-	if err != nil {
-		return errors.New("Failed to build request: " + err.Error())
-	}
+	return store.call(c, params, &response)
+}
 
-	c.SignRequest(req)
+// Charge a sender's payment token. Returns the id and status of the
+// new transaction.
+func (store Store) Pay(c Context, senderTokenId, callerReference string, amount Money) (transactionId, status string, err error) {
 
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return errors.New("Failed to contact Amazon: " + err.Error())
+	if amount.Amount <= 0 {
+		return "", "", errors.New("Cannot pay a non-positive amount: " + amount.String())
 	}
 
+	params := make(url.Values)
+	params.Set("Action", "Pay")
+	params.Set("SenderTokenId", senderTokenId)
+	params.Set("CallerReference", callerReference)
+	params.Set("TransactionAmount.CurrencyCode", amount.Currency)
+	params.Set("TransactionAmount.Value", amount.Value())
+
 	var response struct {
-		SettleResult struct {
+		PayResult struct {
 			TransactionId     string
 			TransactionStatus string
 		}
-		Errors struct {
-			Error []struct {
-				Code    string
-				Message string
-			}
-		}
+		fpsErrorResponse
 	}
 
-	err = xml.NewDecoder(resp.Body).Decode(&response)
-	resp.Body.Close()
-	if err != nil {
-		return errors.New("Failed to decode response from Amazon: " + err.Error())
+	if err := store.call(c, params, &response); err != nil {
+		return "", "", err
 	}
 
-	if len(response.Errors.Error) > 0 {
-		return errors.New("Amazon returned an error: " + response.Errors.Error[0].Message)
+	return response.PayResult.TransactionId, response.PayResult.TransactionStatus, nil
+}
+
+// Refund a transaction. A zero amount refunds the full transaction.
+// Returns the id and status of the refund transaction.
+func (store Store) Refund(c Context, transactionId, callerReference string, amount Money) (refundTransactionId, status string, err error) {
+
+	if amount.Amount < 0 {
+		return "", "", errors.New("Cannot refund a negative amount: " + amount.String())
 	}
 
-	return nil
+	params := make(url.Values)
+	params.Set("Action", "Refund")
+	params.Set("TransactionId", transactionId)
+	params.Set("CallerReference", callerReference)
+	if amount.Amount != 0 {
+		params.Set("RefundAmount.CurrencyCode", amount.Currency)
+		params.Set("RefundAmount.Value", amount.Value())
+	}
+
+	var response struct {
+		RefundResult struct {
+			TransactionId     string
+			TransactionStatus string
+		}
+		fpsErrorResponse
+	}
+
+	if err := store.call(c, params, &response); err != nil {
+		return "", "", err
+	}
+
+	return response.RefundResult.TransactionId, response.RefundResult.TransactionStatus, nil
 }
 
 // Verify the parameters for a set of FPS parameters
@@ -189,50 +340,419 @@ func (store Store) VerifyPaymentParams(c Context, v url.Values) error {
 	params.Set("Action", "VerifySignature")
 	params.Set("UrlEndPoint", store.ReturnURL)
 	params.Set("HttpParameters", v.Encode())
-	params.Set("Version", "2008-09-17")
 
-	host := "https://fps.amazonaws.com/?"
+	var response struct {
+		VerifySignatureResult struct {
+			VerificationStatus string
+		}
+		fpsErrorResponse
+	}
+
+	if err := store.call(c, params, &response); err != nil {
+		return err
+	}
+
+	if response.VerifySignatureResult.VerificationStatus != "Success" {
+		return errors.New("Invalid signature verification: " + response.VerifySignatureResult.VerificationStatus)
+	}
+
+	return nil
+}
+
+// Describes an FPS payment token.
+type Token struct {
+	TokenId       string
+	TokenStatus   string
+	FriendlyName  string
+	PaymentReason string
+}
+
+// Lookup a token by the caller reference used when it was installed
+func (store Store) GetTokenByCaller(c Context, callerReference string) (*Token, error) {
+
+	params := make(url.Values)
+	params.Set("Action", "GetTokenByCaller")
+	params.Set("CallerReference", callerReference)
+
+	var response struct {
+		GetTokenByCallerResult struct {
+			Token Token
+		}
+		fpsErrorResponse
+	}
+
+	if err := store.call(c, params, &response); err != nil {
+		return nil, err
+	}
+
+	return &response.GetTokenByCallerResult.Token, nil
+}
+
+// The payment instruction behind an FPS token, describing the terms
+// that govern payments made with it.
+type PaymentInstruction struct {
+	TokenId         string
+	CallerReference string
+	FriendlyName    string
+	TokenType       string
+
+	// Status of the token, e.g. "Active" or "Inactive".
+	Status        string
+	DateInstalled time.Time
+
+	// The instruction itself, in the GateKeeper language.
+	Instruction string
+
+	// Id of the account that installed the token.
+	AccountId string
+}
+
+// Get the payment instruction and metadata of a token, e.g. to document
+// the terms that governed a disputed payment.
+func (store Store) GetPaymentInstruction(c Context, tokenId string) (*PaymentInstruction, error) {
+
+	params := make(url.Values)
+	params.Set("Action", "GetPaymentInstruction")
+	params.Set("TokenId", tokenId)
+
+	var response struct {
+		GetPaymentInstructionResult struct {
+			Token struct {
+				TokenId         string
+				CallerReference string
+				FriendlyName    string
+				TokenType       string
+				TokenStatus     string
+				DateInstalled   time.Time
+			}
+			PaymentInstruction string
+			AccountId          string
+		}
+		fpsErrorResponse
+	}
+
+	if err := store.call(c, params, &response); err != nil {
+		return nil, err
+	}
+
+	result := response.GetPaymentInstructionResult
+	return &PaymentInstruction{
+		TokenId:         result.Token.TokenId,
+		CallerReference: result.Token.CallerReference,
+		FriendlyName:    result.Token.FriendlyName,
+		TokenType:       result.Token.TokenType,
+		Status:          result.Token.TokenStatus,
+		DateInstalled:   result.Token.DateInstalled,
+		Instruction:     result.PaymentInstruction,
+		AccountId:       result.AccountId,
+	}, nil
+}
+
+// Verify FPS is reachable with the given credentials by requesting the
+// account balance. Failures are returned as a *PingError.
+func (store Store) Ping(c Context) error {
+
+	params := make(url.Values)
+	params.Set("Action", "GetAccountBalance")
+
+	var response struct {
+		fpsErrorResponse
+	}
+
+	if err := store.call(c, params, &response); err != nil {
+		return &PingError{Service: ServiceFPS, Err: err}
+	}
+
+	return nil
+}
+
+// Get the FPS endpoint for the store.
+func (store Store) fpsEndpoint() string {
 	if store.Sandbox {
-		host = "https://fps.sandbox.amazonaws.com/?"
+		return "https://fps.sandbox.amazonaws.com/"
 	}
 
-	req, err := http.NewRequest("GET", host+params.Encode(), nil)
+	return "https://fps.amazonaws.com/"
+}
+
+// A decoded FPS response, which reports any errors it contains.
+type fpsResponse interface {
+	err() error
+}
+
+// Send a signed FPS request and decode the response into `v`. Errors
+// reported by FPS are returned as an *AWSError.
+func (store Store) call(c Context, params url.Values, v fpsResponse) error {
+
+	params.Set("Version", store.apiVersion())
+
+	req, err := http.NewRequest("GET", store.fpsEndpoint()+"?"+params.Encode(), nil)
 	if err != nil {
 		return errors.New("Failed to build request: " + err.Error())
 	}
 
-	c.SignRequest(req)
+	if err := c.SignRequest(req); err != nil {
+		return err
+	}
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := c.do(req, 0)
 	if err != nil {
 		return errors.New("Failed to contact Amazon: " + err.Error())
 	}
 
+	err = xml.NewDecoder(resp.Body).Decode(v)
+	closeBody(resp)
+	if err != nil {
+		return errors.New("Failed to decode response from Amazon: " + err.Error())
+	}
+
+	return v.err()
+}
+
+// An amount in an FPS response.
+type fpsAmount struct {
+	CurrencyCode string
+	Value        string
+}
+
+func (a fpsAmount) money() (Money, error) {
+	return ParseMoney(a.CurrencyCode + " " + a.Value)
+}
+
+// Get the available and pending balances of a prepaid instrument.
+func (store Store) GetPrepaidBalance(c Context, prepaidInstrumentId string) (available, pending Money, err error) {
+
+	params := make(url.Values)
+	params.Set("Action", "GetPrepaidBalance")
+	params.Set("PrepaidInstrumentId", prepaidInstrumentId)
+
 	var response struct {
-		VerifySignatureResult struct {
-			VerificationStatus string
+		GetPrepaidBalanceResult struct {
+			PrepaidBalance struct {
+				AvailableBalance fpsAmount
+				PendingInBalance fpsAmount
+			}
 		}
-		Errors struct {
-			Error []struct {
-				Code    string
-				Message string
+		fpsErrorResponse
+	}
+
+	if err := store.call(c, params, &response); err != nil {
+		return Money{}, Money{}, err
+	}
+
+	balance := response.GetPrepaidBalanceResult.PrepaidBalance
+	if available, err = balance.AvailableBalance.money(); err != nil {
+		return Money{}, Money{}, errors.New("Failed to decode response from Amazon: " + err.Error())
+	}
+	if pending, err = balance.PendingInBalance.money(); err != nil {
+		return Money{}, Money{}, errors.New("Failed to decode response from Amazon: " + err.Error())
+	}
+
+	return available, pending, nil
+}
+
+// Get the outstanding and pending balances of a credit instrument.
+func (store Store) GetOutstandingDebtBalance(c Context, creditInstrumentId string) (outstanding, pending Money, err error) {
+
+	params := make(url.Values)
+	params.Set("Action", "GetOutstandingDebtBalance")
+	params.Set("CreditInstrumentId", creditInstrumentId)
+
+	var response struct {
+		GetOutstandingDebtBalanceResult struct {
+			OutstandingDebt struct {
+				OutstandingBalance fpsAmount
+				PendingOutBalance  fpsAmount
 			}
 		}
+		fpsErrorResponse
+	}
+
+	if err := store.call(c, params, &response); err != nil {
+		return Money{}, Money{}, err
+	}
+
+	debt := response.GetOutstandingDebtBalanceResult.OutstandingDebt
+	if outstanding, err = debt.OutstandingBalance.money(); err != nil {
+		return Money{}, Money{}, errors.New("Failed to decode response from Amazon: " + err.Error())
+	}
+	if pending, err = debt.PendingOutBalance.money(); err != nil {
+		return Money{}, Money{}, errors.New("Failed to decode response from Amazon: " + err.Error())
+	}
+
+	return outstanding, pending, nil
+}
+
+// Verify the parameters for a set of FPS parameters locally, using the
+// certificate referenced by the parameters' `certificateUrl` rather than
+// a round trip to Amazon. The certificate must be served over HTTPS by
+// FPS, chain to a trusted root and be issued to the FPS host it was
+// served from. `method` is the HTTP method the parameters were
+// delivered with: "GET" for return URL redirects, "POST" for IPN
+// notifications. Parameters that are not signed with SignatureVersion 2
+// and RSA-SHA1 are verified remotely using VerifyPaymentParams.
+func (store Store) VerifyPaymentParamsLocal(c Context, method string, v url.Values) error {
+
+	certURL := v.Get("certificateUrl")
+	if v.Get("signatureVersion") != "2" || v.Get("signatureMethod") != "RSA-SHA1" || certURL == "" {
+		return store.VerifyPaymentParams(c, v)
 	}
 
-	err = xml.NewDecoder(resp.Body).Decode(&response)
-	resp.Body.Close()
+	signature, err := base64.StdEncoding.DecodeString(v.Get("signature"))
 	if err != nil {
-		return errors.New("Failed to decode response from Amazon: " + err.Error())
+		return errors.New("Malformed signature: " + err.Error())
 	}
 
-	if len(response.Errors.Error) > 0 {
-		return errors.New("Failed to validate signature: " + response.Errors.Error[0].Message)
+	endpoint, err := url.Parse(store.ReturnURL)
+	if err != nil {
+		return errors.New("Malformed return URL: " + err.Error())
 	}
 
-	if response.VerifySignatureResult.VerificationStatus != "Success" {
-		return errors.New("Invalid signature verification: " + response.VerifySignatureResult.VerificationStatus)
+	cert, err := fetchFPSCertificate(c, certURL)
+	if err != nil {
+		return err
+	}
+
+	pub, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return errors.New("Certificate does not contain an RSA key")
+	}
+
+	// Canonical parameters, sorted by name, excluding the signature
+	keys := make([]string, 0, len(v))
+	for key := range v {
+		if key != "signature" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	query := make([]string, len(keys))
+	for ii, key := range keys {
+		query[ii] = awsEncode(key) + "=" + awsEncode(v.Get(key))
+	}
+
+	path := endpoint.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+
+	signString := strings.ToUpper(method) + "\n" + strings.ToLower(endpoint.Host) + "\n" + path + "\n" + strings.Join(query, "&")
+	digest := sha1.Sum([]byte(signString))
+	if err := rsa.VerifyPKCS1v15(pub, crypto.SHA1, digest[:], signature); err != nil {
+		return errors.New("Invalid signature: " + err.Error())
 	}
 
 	return nil
 }
+
+// Describes an FPS transaction.
+type Transaction struct {
+	TransactionId   string
+	CallerReference string
+
+	// FPS operation that created the transaction, e.g. "Pay".
+	Operation string
+
+	// Status of the transaction, e.g. "Success" or "Pending".
+	Status        string
+	StatusCode    string
+	StatusMessage string
+
+	Amount        Money
+	DateReceived  time.Time
+	DateCompleted time.Time
+}
+
+// How far back GetTransactionsByCallerReference searches for
+// transactions.
+const CallerReferenceLookback = 90 * 24 * time.Hour
+
+// Maximum number of account activity pages GetTransactionsByCallerReference
+// requests before giving up.
+const maxAccountActivityPages = 100
+
+// Returned by GetTransactionsByCallerReference, along with the
+// transactions found so far, when the account activity has more pages
+// than it will request.
+var ErrTooManyPages = errors.New("Too many account activity pages")
+
+// Find the transactions created with a caller reference. FPS has no
+// lookup by caller reference, so this pages through the account
+// activity of the last CallerReferenceLookback and returns matching
+// transactions, oldest first. Paging stops when FPS returns no next
+// page or a next page that doesn't advance. After 100 pages, the
+// transactions found so far are returned with an error wrapping
+// ErrTooManyPages.
+func (store Store) GetTransactionsByCallerReference(c Context, callerReference string) ([]Transaction, error) {
+
+	var transactions []Transaction
+	start := time.Now().Add(-CallerReferenceLookback).UTC().Format(time.RFC3339)
+	for page := 0; start != ""; page++ {
+		if err := c.context().Err(); err != nil {
+			return nil, err
+		}
+
+		if page == maxAccountActivityPages {
+			return transactions, fmt.Errorf("%w: account activity exceeds %d pages", ErrTooManyPages, maxAccountActivityPages)
+		}
+
+		params := make(url.Values)
+		params.Set("Action", "GetAccountActivity")
+		params.Set("StartDate", start)
+		params.Set("SortOrderByDate", "Ascending")
+
+		var response struct {
+			GetAccountActivityResult struct {
+				StartTimeForNextTransaction string
+				Transaction                 []struct {
+					TransactionId     string
+					CallerReference   string
+					FPSOperation      string
+					TransactionStatus string
+					StatusCode        string
+					StatusMessage     string
+					TransactionAmount fpsAmount
+					DateReceived      time.Time
+					DateCompleted     time.Time
+				}
+			}
+			fpsErrorResponse
+		}
+
+		if err := store.call(c, params, &response); err != nil {
+			return nil, err
+		}
+
+		for _, t := range response.GetAccountActivityResult.Transaction {
+			if t.CallerReference != callerReference {
+				continue
+			}
+
+			amount, err := t.TransactionAmount.money()
+			if err != nil {
+				return nil, errors.New("Failed to decode response from Amazon: " + err.Error())
+			}
+
+			transactions = append(transactions, Transaction{
+				TransactionId:   t.TransactionId,
+				CallerReference: t.CallerReference,
+				Operation:       t.FPSOperation,
+				Status:          t.TransactionStatus,
+				StatusCode:      t.StatusCode,
+				StatusMessage:   t.StatusMessage,
+				Amount:          amount,
+				DateReceived:    t.DateReceived,
+				DateCompleted:   t.DateCompleted,
+			})
+		}
+
+		next := response.GetAccountActivityResult.StartTimeForNextTransaction
+		if next == start {
+			break
+		}
+		start = next
+	}
+
+	return transactions, nil
+}
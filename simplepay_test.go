@@ -0,0 +1,368 @@
+// Copyright 2012 Matthew Endsley
+// All rights reserved
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted providing that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+// STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+// IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package goaws
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Sign FPS parameters delivered to the store's return URL with
+// `method`, as FPS does.
+func signTestPaymentParams(t *testing.T, store Store, method string, key *rsa.PrivateKey, v url.Values) {
+
+	endpoint, err := url.Parse(store.ReturnURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys := make([]string, 0, len(v))
+	for key := range v {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	query := make([]string, len(keys))
+	for ii, key := range keys {
+		query[ii] = awsEncode(key) + "=" + awsEncode(v.Get(key))
+	}
+
+	digest := sha1.Sum([]byte(method + "\n" + endpoint.Host + "\n" + endpoint.Path + "\n" + strings.Join(query, "&")))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA1, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v.Set("signature", base64.StdEncoding.EncodeToString(signature))
+}
+
+func TestVerifyPaymentParamsLocal(t *testing.T) {
+
+	pki := newTestPKI(t)
+	genuine := newTestCert(t, "fps.amazonaws.com", false, pki.intermediate, testIntermediateURL)
+	forged := newTestCert(t, "fps.amazonaws.com", false, nil, "")
+
+	const (
+		genuineURL = "https://fps.amazonaws.com/certs/090911/PKICert.pem"
+		forgedURL  = "https://fps.amazonaws.com/certs/forged/PKICert.pem"
+		bucketURL  = "https://attacker.s3.amazonaws.com/certs/090911/PKICert.pem"
+	)
+	pki.transport[genuineURL] = genuine.pem()
+	pki.transport[forgedURL] = forged.pem()
+	pki.transport[bucketURL] = forged.pem()
+
+	c := NewContext("id", "key")
+	c.Transport = pki.transport
+	store := Store{ReturnURL: "https://shop.example.com/return"}
+
+	tests := []struct {
+		name    string
+		certURL string
+		key     *rsa.PrivateKey
+
+		// Method the parameters are signed for, and delivered with
+		signed    string
+		delivered string
+		valid     bool
+	}{
+		{"genuine", genuineURL, genuine.key, "GET", "GET", true},
+		{"genuine IPN", genuineURL, genuine.key, "POST", "POST", true},
+		{"lowercase method", genuineURL, genuine.key, "POST", "post", true},
+		{"wrong method", genuineURL, genuine.key, "POST", "GET", false},
+		{"wrong key", genuineURL, forged.key, "GET", "GET", false},
+		{"untrusted certificate", forgedURL, forged.key, "GET", "GET", false},
+		{"non-FPS host", bucketURL, forged.key, "GET", "GET", false},
+	}
+
+	for _, tt := range tests {
+		v := url.Values{
+			"transactionId":    {"txn"},
+			"status":           {"PS"},
+			"signatureVersion": {"2"},
+			"signatureMethod":  {"RSA-SHA1"},
+			"certificateUrl":   {tt.certURL},
+		}
+		signTestPaymentParams(t, store, tt.signed, tt.key, v)
+
+		err := store.VerifyPaymentParamsLocal(c, tt.delivered, v)
+		if tt.valid && err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+		} else if !tt.valid && err == nil {
+			t.Errorf("%s: accepted", tt.name)
+		}
+	}
+}
+
+func TestFPSRequests(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		action string
+		call   func(store Store, c Context) error
+	}{
+		{"Settle", "Settle", func(store Store, c Context) error {
+			return store.Settle(c, "txn", Money{Currency: "USD", Amount: 100})
+		}},
+		{"Pay", "Pay", func(store Store, c Context) error {
+			_, _, err := store.Pay(c, "token", "ref", Money{Currency: "USD", Amount: 100})
+			return err
+		}},
+		{"Refund", "Refund", func(store Store, c Context) error {
+			_, _, err := store.Refund(c, "txn", "ref", Money{})
+			return err
+		}},
+		{"VerifyPaymentParams", "VerifySignature", func(store Store, c Context) error {
+			return store.VerifyPaymentParams(c, url.Values{"status": {"PS"}})
+		}},
+		{"GetTokenByCaller", "GetTokenByCaller", func(store Store, c Context) error {
+			_, err := store.GetTokenByCaller(c, "ref")
+			return err
+		}},
+		{"Ping", "GetAccountBalance", func(store Store, c Context) error {
+			return store.Ping(c)
+		}},
+	}
+
+	const errorResponse = `<Response><Errors><Error><Code>InvalidClientTokenId</Code><Message>Invalid token</Message></Error></Errors><RequestID>request-id</RequestID></Response>`
+
+	for _, tt := range tests {
+		var requested *url.URL
+		c := NewContext("id", "key")
+		c.Transport = roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			requested = r.URL
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       io.NopCloser(strings.NewReader(errorResponse)),
+				Request:    r,
+			}, nil
+		})
+
+		store := Store{Sandbox: true, ReturnURL: "https://shop.example.com/return", APIVersion: "2010-08-28"}
+		err := tt.call(store, c)
+
+		if requested == nil {
+			t.Errorf("%s: no request sent", tt.name)
+			continue
+		}
+		if requested.Host != "fps.sandbox.amazonaws.com" {
+			t.Errorf("%s: sent to %s, want the sandbox endpoint", tt.name, requested.Host)
+		}
+		if query := requested.Query(); query.Get("Action") != tt.action || query.Get("Version") != "2010-08-28" {
+			t.Errorf("%s: Action = %q, Version = %q", tt.name, query.Get("Action"), query.Get("Version"))
+		}
+
+		var awsErr *AWSError
+		if !errors.As(err, &awsErr) || awsErr.Code != "InvalidClientTokenId" {
+			t.Errorf("%s: error = %v, want InvalidClientTokenId", tt.name, err)
+		}
+
+		var pingErr *PingError
+		if tt.name == "Ping" && (!errors.As(err, &pingErr) || pingErr.Service != ServiceFPS) {
+			t.Errorf("%s: error = %v, want a *PingError", tt.name, err)
+		}
+	}
+}
+
+func TestPayRefundAmounts(t *testing.T) {
+
+	tests := []struct {
+		name string
+		call func(store Store, c Context) error
+		want url.Values
+		err  bool
+	}{
+		{"pay", func(store Store, c Context) error {
+			_, _, err := store.Pay(c, "token", "ref", Money{Currency: "USD", Amount: 1234})
+			return err
+		}, url.Values{"TransactionAmount.CurrencyCode": {"USD"}, "TransactionAmount.Value": {"12.34"}}, false},
+		{"pay nothing", func(store Store, c Context) error {
+			_, _, err := store.Pay(c, "token", "ref", Money{Currency: "USD"})
+			return err
+		}, nil, true},
+		{"pay negative", func(store Store, c Context) error {
+			_, _, err := store.Pay(c, "token", "ref", Money{Currency: "USD", Amount: -5})
+			return err
+		}, nil, true},
+		{"partial refund", func(store Store, c Context) error {
+			_, _, err := store.Refund(c, "txn", "ref", Money{Currency: "USD", Amount: 5})
+			return err
+		}, url.Values{"RefundAmount.CurrencyCode": {"USD"}, "RefundAmount.Value": {"0.05"}}, false},
+		{"full refund", func(store Store, c Context) error {
+			_, _, err := store.Refund(c, "txn", "ref", Money{})
+			return err
+		}, url.Values{"RefundAmount.Value": nil}, false},
+		{"refund negative", func(store Store, c Context) error {
+			_, _, err := store.Refund(c, "txn", "ref", Money{Currency: "USD", Amount: -5})
+			return err
+		}, nil, true},
+	}
+
+	for _, tt := range tests {
+		var requested url.Values
+		c := NewContext("id", "key")
+		c.Transport = roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			requested = r.URL.Query()
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       io.NopCloser(strings.NewReader(`<Response><TransactionId>new</TransactionId></Response>`)),
+				Request:    r,
+			}, nil
+		})
+
+		err := tt.call(Store{}, c)
+		if tt.err != (err != nil) {
+			t.Errorf("%s: error = %v", tt.name, err)
+		}
+		if tt.err {
+			if requested != nil {
+				t.Errorf("%s: request sent for an invalid amount", tt.name)
+			}
+			continue
+		}
+
+		for key, values := range tt.want {
+			if strings.Join(requested[key], ",") != strings.Join(values, ",") {
+				t.Errorf("%s: %s = %q, want %q", tt.name, key, requested[key], values)
+			}
+		}
+	}
+}
+
+// Format a GetAccountActivity response page holding a transaction with
+// caller reference `ref`, followed by the page starting at `next`.
+func testAccountActivity(ref, next string) string {
+	return `<GetAccountActivityResponse><GetAccountActivityResult>` +
+		`<StartTimeForNextTransaction>` + next + `</StartTimeForNextTransaction>` +
+		`<Transaction><TransactionId>txn-` + ref + `</TransactionId><CallerReference>` + ref + `</CallerReference>` +
+		`<TransactionAmount><CurrencyCode>USD</CurrencyCode><Value>1.00</Value></TransactionAmount></Transaction>` +
+		`</GetAccountActivityResult></GetAccountActivityResponse>`
+}
+
+func TestGetTransactionsByCallerReference(t *testing.T) {
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+
+		// Build the response to the page starting at `start`, the
+		// `page`th request.
+		page func(page int, start string) string
+
+		requests     int
+		transactions int
+		err          bool
+	}{
+		{
+			name: "pages until no next page",
+			page: func(page int, start string) string {
+				if page == 2 {
+					return testAccountActivity("ref", "")
+				}
+				return testAccountActivity("ref", "2020-01-0"+strconv.Itoa(page+1)+"T00:00:00Z")
+			},
+			requests:     3,
+			transactions: 3,
+		},
+		{
+			name: "next page doesn't advance",
+			page: func(page int, start string) string {
+				return testAccountActivity("ref", start)
+			},
+			requests:     1,
+			transactions: 1,
+		},
+		{
+			name: "too many pages",
+			page: func(page int, start string) string {
+				ref := "other"
+				if page%10 == 0 {
+					ref = "ref"
+				}
+				return testAccountActivity(ref, time.Unix(int64(page), 0).UTC().Format(time.RFC3339))
+			},
+			requests:     maxAccountActivityPages,
+			transactions: maxAccountActivityPages / 10,
+			err:          true,
+		},
+		{
+			name: "cancelled",
+			ctx:  cancelled,
+			page: func(page int, start string) string {
+				return testAccountActivity("ref", "")
+			},
+			err: true,
+		},
+	}
+
+	for _, tt := range tests {
+		requests := 0
+		c := NewContext("id", "key")
+		c.Transport = roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			body := tt.page(requests, r.URL.Query().Get("StartDate"))
+			requests++
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       io.NopCloser(strings.NewReader(body)),
+				Request:    r,
+			}, nil
+		})
+		if tt.ctx != nil {
+			c = c.WithContext(tt.ctx)
+		}
+
+		transactions, err := Store{}.GetTransactionsByCallerReference(c, "ref")
+		if tt.err != (err != nil) {
+			t.Errorf("%s: error = %v", tt.name, err)
+		}
+		if tt.ctx != nil && !errors.Is(err, context.Canceled) {
+			t.Errorf("%s: error = %v, want context.Canceled", tt.name, err)
+		}
+		if tt.name == "too many pages" && !errors.Is(err, ErrTooManyPages) {
+			t.Errorf("%s: error = %v, want ErrTooManyPages", tt.name, err)
+		}
+		if requests != tt.requests {
+			t.Errorf("%s: sent %d requests, want %d", tt.name, requests, tt.requests)
+		}
+		if len(transactions) != tt.transactions {
+			t.Errorf("%s: got %d transactions, want %d", tt.name, len(transactions), tt.transactions)
+		}
+	}
+}
@@ -25,18 +25,45 @@
 package goaws
 
 import (
-	"encoding/xml"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
 )
 
 // A context holding the ARN/host pair for an SNS topic.
 type Topic struct {
 	host string
 	arn  string
+
+	// Maximum size in bytes of a published message. Zero uses the
+	// SNS limit of 256KB, which applies to both standard and FIFO
+	// topics.
+	MaxMessageSize int
+
+	// Send requests to the SNS endpoint of the region in the topic
+	// ARN rather than the host passed to NewTopic. Requests are signed
+	// for the host they are sent to, so this avoids signing mismatches
+	// when publishing to topics in other regions or accounts.
+	UseARNRegion bool
+
+	// Send requests to the dualstack (IPv4 and IPv6) SNS endpoint of
+	// the region in the topic ARN. Implies UseARNRegion.
+	Dualstack bool
+
+	// Base URL of a local endpoint set by UseLocal.
+	local string
 }
 
+// Default maximum size of an SNS message, in bytes.
+const DefaultMaxMessageSize = 256 * 1024
+
+// Returned when a message is too large to be published.
+var ErrMessageTooLarge = errors.New("Message too large")
+
 // Create an SNS Topic context for a specific host/ARN combination.
 func NewTopic(host, arn string) Topic {
 	return Topic{
@@ -45,40 +72,733 @@ func NewTopic(host, arn string) Topic {
 	}
 }
 
+// Create an SNS Topic context from a topic ARN, deriving the host from
+// the region in the ARN. Use NewTopic to override the host.
+func NewTopicFromARN(arn string) (Topic, error) {
+	host, err := snsHostForARN(arn, false)
+	if err != nil {
+		return Topic{}, err
+	}
+
+	return NewTopic(host, arn), nil
+}
+
+// Get the ARN of the topic.
+func (t Topic) ARN() string {
+	return t.arn
+}
+
+// Get the SNS host the topic was created with. Requests may be sent
+// elsewhere when UseARNRegion, Dualstack or UseLocal apply.
+func (t Topic) Host() string {
+	return t.host
+}
+
+// Create a topic named `name` on the SNS host, with optional
+// `attributes` (e.g. "DisplayName" or "FifoTopic"), which may be nil.
+//
+// If the topic already exists with the same attributes, the existing
+// topic is returned. SNS reports a topic that exists with different
+// attributes only through the generic InvalidParameter code, so that
+// failure is returned as the *AWSError from SNS.
+func CreateTopic(c Context, host, name string, attributes map[string]string) (Topic, error) {
+
+	params := make(url.Values)
+	params.Set("Name", name)
+	encodeAttributeMap(params, attributes)
+	params.Set("Action", "CreateTopic")
+
+	req, err := c.newPostRequest("https://"+host+"/", params)
+	if err != nil {
+		return Topic{}, err
+	}
+
+	var response struct {
+		CreateTopicResult struct {
+			TopicArn string
+		}
+	}
+
+	if err := c.call(req, &response); err != nil {
+		return Topic{}, err
+	}
+
+	return NewTopic(host, response.CreateTopicResult.TopicArn), nil
+}
+
+// Get the SNS endpoint host for the region in a topic ARN of the form
+// "arn:<partition>:sns:<region>:<account>:<name>".
+func snsHostForARN(arn string, dualstack bool) (string, error) {
+
+	parsed, err := ParseARN(arn)
+	if err != nil || parsed.Service != "sns" || parsed.Region == "" || parsed.AccountId == "" || strings.Contains(parsed.Resource, ":") {
+		return "", errors.New("Malformed SNS topic ARN: " + arn)
+	}
+
+	return serviceHost("sns", parsed.Region, dualstack), nil
+}
+
+// Get the URL requests for the topic are sent to.
+func (t Topic) endpoint() (string, error) {
+	if t.local != "" {
+		return t.local, nil
+	}
+
+	host := t.host
+	if t.UseARNRegion || t.Dualstack {
+		var err error
+		if host, err = snsHostForARN(t.arn, t.Dualstack); err != nil {
+			return "", err
+		}
+	}
+
+	return "https://" + host + "/", nil
+}
+
+// Create a copy of the topic whose requests are sent to a local
+// endpoint, such as "http://localhost:4566" for localstack, instead of
+// SNS. The topic ARN is unchanged.
+func (t Topic) UseLocal(endpoint string) (Topic, error) {
+
+	local, err := url.Parse(endpoint)
+	if err != nil || local.Scheme == "" || local.Host == "" {
+		return Topic{}, errors.New("Malformed local endpoint: " + endpoint)
+	}
+
+	t.local = local.Scheme + "://" + local.Host + "/"
+	return t, nil
+}
+
+// Result of publishing a message to an SNS topic.
+type PublishResult struct {
+	MessageId      string
+	RequestId      string
+	SequenceNumber string
+
+	// Hex encoded MD5 digest of the UTF-8 message bytes sent to SNS.
+	// SNS doesn't return a digest; this is computed locally.
+	MD5OfMessage string
+}
+
 // Publish a message to the SNS topic using the specified Context to
 // sign the request.
 func (t Topic) Publish(c Context, body string) (messageId, requestId string, err error) {
+	result, err := t.PublishResult(c, body)
+	if err != nil {
+		return "", "", err
+	}
+
+	return result.MessageId, result.RequestId, nil
+}
+
+// Publish a message to the SNS topic using the specified Context to
+// sign the request. Returns the full result of the publish.
+func (t Topic) PublishResult(c Context, body string) (PublishResult, error) {
+
+	params, err := t.publishParams(body)
+	if err != nil {
+		return PublishResult{}, err
+	}
+
+	return t.publish(c, params, body)
+}
+
+// A message to publish with Topic.PublishMessage.
+type PublishInput struct {
+	Message string
+
+	// Subject line used by email endpoints. At most 100 characters.
+	Subject string
+
+	// Set to "json" to send a different message to each protocol.
+	// Message must then be a JSON object of messages keyed by
+	// protocol, including a "default" message.
+	MessageStructure string
+
+	MessageAttributes MessageAttributes
+
+	// Ordering group of the message. Required for FIFO topics, and
+	// not allowed for standard topics.
+	MessageGroupId string
+
+	// Token used to deduplicate publishes to a FIFO topic within the
+	// 5 minute deduplication interval. Optional when the topic uses
+	// content based deduplication.
+	MessageDeduplicationId string
+
+	// Send an SMS to this phone number instead of publishing to the
+	// topic. Mutually exclusive with TargetArn.
+	PhoneNumber string
+
+	// Publish directly to this endpoint ARN (e.g. a mobile platform
+	// endpoint) instead of the topic. Mutually exclusive with
+	// PhoneNumber.
+	TargetArn string
+}
+
+// Maximum length of a message subject.
+const maxSubjectLength = 100
+
+// Get the size of the message as counted by SNS: the UTF-8 encoded
+// message plus its attributes.
+func (msg PublishInput) size() int {
+	return len(msg.Message) + msg.MessageAttributes.size()
+}
+
+// Validate a message before publishing it.
+func (t Topic) validatePublish(msg PublishInput) error {
+
+	if size, max := msg.size(), t.maxMessageSize(); size > max {
+		return fmt.Errorf("%w: %d bytes exceeds the limit of %d bytes", ErrMessageTooLarge, size, max)
+	}
+
+	if msg.PhoneNumber != "" && msg.TargetArn != "" {
+		return errors.New("Only one of a phone number and a target ARN may be given")
+	}
+
+	if len(msg.Subject) > maxSubjectLength {
+		return fmt.Errorf("Subject must be no longer than %d characters. Got: %d", maxSubjectLength, len(msg.Subject))
+	}
+
+	if msg.MessageStructure != "" && msg.MessageStructure != "json" {
+		return errors.New("Unsupported message structure: " + msg.MessageStructure)
+	}
+
+	toTopic := msg.PhoneNumber == "" && msg.TargetArn == ""
+	if msg.MessageGroupId != "" || msg.MessageDeduplicationId != "" {
+		if !toTopic || !t.isFIFO() {
+			return errors.New("Message group ids are only supported by FIFO topics: " + t.arn)
+		}
+	} else if toTopic && t.isFIFO() {
+		return errors.New("FIFO topics require a message group id")
+	}
+
+	if err := validateFIFOToken("Message group id", msg.MessageGroupId); err != nil {
+		return err
+	}
+
+	return validateFIFOToken("Message deduplication id", msg.MessageDeduplicationId)
+}
+
+// Add the message fields to request parameters, each name prefixed
+// with `prefix`.
+func (msg PublishInput) encode(params url.Values, prefix string) {
+	params.Set(prefix+"Message", msg.Message)
+	if msg.Subject != "" {
+		params.Set(prefix+"Subject", msg.Subject)
+	}
+	if msg.MessageStructure != "" {
+		params.Set(prefix+"MessageStructure", msg.MessageStructure)
+	}
+	msg.MessageAttributes.encode(params, prefix+"MessageAttributes.entry")
+	if msg.MessageGroupId != "" {
+		params.Set(prefix+"MessageGroupId", msg.MessageGroupId)
+	}
+	if msg.MessageDeduplicationId != "" {
+		params.Set(prefix+"MessageDeduplicationId", msg.MessageDeduplicationId)
+	}
+}
+
+// Publish a message using the specified Context to sign the request.
+// The message is published to the topic unless it is addressed to a
+// phone number or target ARN.
+func (t Topic) PublishMessage(c Context, msg PublishInput) (PublishResult, error) {
+
+	if err := t.validatePublish(msg); err != nil {
+		return PublishResult{}, err
+	}
 
 	params := make(url.Values)
-	params.Set("TopicArn", t.arn)
-	params.Set("Message", body)
 	params.Set("Action", "Publish")
+	switch {
+	case msg.PhoneNumber != "":
+		params.Set("PhoneNumber", msg.PhoneNumber)
+	case msg.TargetArn != "":
+		params.Set("TargetArn", msg.TargetArn)
+	default:
+		params.Set("TopicArn", t.arn)
+	}
+	msg.encode(params, "")
+
+	return t.publish(c, params, msg.Message)
+}
+
+// Publish up to 10 messages to the topic in a single request. Returns
+// a result for each input, in order, and a map of input index (as a
+// decimal string) to error message for each message that could not be
+// published. Results of failed messages are zero values. Messages can't
+// be addressed to a phone number or target ARN.
+func (t Topic) PublishBatch(c Context, inputs []PublishInput) ([]PublishResult, map[string]string, error) {
+
+	if len(inputs) == 0 {
+		return nil, nil, errors.New("Batch must contain at least one entry")
+	} else if len(inputs) > maxBatchEntries {
+		return nil, nil, fmt.Errorf("%w: must contain no more than %d entries. Got: %d", ErrBatchTooLarge, maxBatchEntries, len(inputs))
+	}
+
+	params := make(url.Values)
+	params.Set("Action", "PublishBatch")
+	params.Set("TopicArn", t.arn)
+
+	// the size limit applies to the batch as a whole
+	size := 0
+	for ii, msg := range inputs {
+		if msg.PhoneNumber != "" || msg.TargetArn != "" {
+			return nil, nil, errors.New("Batch entries can't be addressed to a phone number or target ARN")
+		}
 
-	req, err := http.NewRequest("GET", "https://"+t.host+"/?"+params.Encode(), nil)
+		if err := t.validatePublish(msg); err != nil {
+			return nil, nil, err
+		}
+
+		size += msg.size()
+		prefix := "PublishBatchRequestEntries.member." + strconv.Itoa(ii+1) + "."
+		params.Set(prefix+"Id", strconv.Itoa(ii))
+		msg.encode(params, prefix)
+	}
+
+	if max := t.maxMessageSize(); size > max {
+		return nil, nil, fmt.Errorf("%w: batch of %d bytes exceeds the limit of %d bytes", ErrMessageTooLarge, size, max)
+	}
+
+	endpoint, err := t.endpoint()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	req, err := c.newPostRequest(endpoint, params)
 	if err != nil {
-		return "", "", errors.New("Failed to create request: " + err.Error())
+		return nil, nil, err
+	}
+
+	var response struct {
+		PublishBatchResult struct {
+			Successful struct {
+				Member []struct {
+					Id             string
+					MessageId      string
+					SequenceNumber string
+				} `xml:"member"`
+			}
+			Failed struct {
+				Member []struct {
+					Id      string
+					Code    string
+					Message string
+				} `xml:"member"`
+			}
+		}
+		ResponseMetadata struct {
+			RequestId string
+		}
+	}
+
+	if err := c.call(req, &response); err != nil {
+		return nil, nil, err
+	}
+
+	entryIndex := func(id string) (int, error) {
+		ii, err := strconv.Atoi(id)
+		if err != nil || ii < 0 || ii >= len(inputs) {
+			return 0, errors.New("Malformed response: unknown batch entry id " + id)
+		}
+
+		return ii, nil
+	}
+
+	results := make([]PublishResult, len(inputs))
+	for _, entry := range response.PublishBatchResult.Successful.Member {
+		ii, err := entryIndex(entry.Id)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		results[ii] = PublishResult{
+			MessageId:      entry.MessageId,
+			RequestId:      response.ResponseMetadata.RequestId,
+			SequenceNumber: entry.SequenceNumber,
+			MD5OfMessage:   md5Hex(inputs[ii].Message),
+		}
+	}
+
+	var failed map[string]string
+	for _, entry := range response.PublishBatchResult.Failed.Member {
+		if _, err := entryIndex(entry.Id); err != nil {
+			return nil, nil, err
+		}
+
+		if failed == nil {
+			failed = make(map[string]string)
+		}
+		failed[entry.Id] = entry.Code + ": " + entry.Message
+	}
+
+	return results, failed, nil
+}
+
+// Publish a message to a FIFO SNS topic. Messages with the same
+// `groupId` are delivered in order, and the group id is passed on to
+// subscribed FIFO queues, which preserve the ordering per group.
+// `deduplicationId` may be empty if the topic uses content based
+// deduplication; otherwise publishes with the same id within 5 minutes
+// are accepted but delivered only once.
+func (t Topic) PublishFIFO(c Context, body, groupId, deduplicationId string) (PublishResult, error) {
+
+	if !t.isFIFO() {
+		return PublishResult{}, errors.New("Message group ids are only supported by FIFO topics: " + t.arn)
+	}
+
+	return t.PublishMessage(c, PublishInput{
+		Message:                body,
+		MessageGroupId:         groupId,
+		MessageDeduplicationId: deduplicationId,
+	})
+}
+
+// Name of the String message attribute carrying a caller supplied
+// external id. See Topic.PublishWithId.
+const ExternalIdAttribute = "external-id"
+
+// Publish a message to the SNS topic tagged with the caller's own
+// `externalId`, so downstream consumers can correlate it. The id is
+// sent as the ExternalIdAttribute message attribute, and can be read
+// back with SQSMessage.ExternalId (raw message delivery) or
+// SNSNotification.ExternalId.
+func (t Topic) PublishWithId(c Context, body, externalId string) (PublishResult, error) {
+
+	if externalId == "" {
+		return PublishResult{}, errors.New("External id must not be empty")
 	}
 
-	c.SignRequest(req)
+	attrs := make(MessageAttributes)
+	attrs.SetString(ExternalIdAttribute, externalId)
 
-	resp, err := http.DefaultClient.Do(req)
+	return t.PublishMessage(c, PublishInput{
+		Message:           body,
+		MessageAttributes: attrs,
+	})
+}
+
+// Is the topic a FIFO topic?
+func (t Topic) isFIFO() bool {
+	return strings.HasSuffix(t.arn, ".fifo")
+}
+
+// Send a Publish request for `body` with the given parameters.
+func (t Topic) publish(c Context, params url.Values, body string) (PublishResult, error) {
+
+	endpoint, err := t.endpoint()
+	if err != nil {
+		return PublishResult{}, err
+	}
+
+	req, err := c.newPostRequest(endpoint, params)
 	if err != nil {
-		return "", "", errors.New("Failed to do request: " + err.Error())
+		return PublishResult{}, err
 	}
 
 	var response struct {
 		PublishResult struct {
-			MessageId string
+			MessageId      string
+			SequenceNumber string
 		}
 		ResponseMetadata struct {
 			RequestId string
 		}
 	}
 
-	defer resp.Body.Close()
-	if err := xml.NewDecoder(resp.Body).Decode(&response); err != nil {
-		return "", "", errors.New("Malformed response: " + err.Error())
+	if err := c.call(req, &response); err != nil {
+		return PublishResult{}, err
+	}
+
+	return PublishResult{
+		MessageId:      response.PublishResult.MessageId,
+		RequestId:      response.ResponseMetadata.RequestId,
+		SequenceNumber: response.PublishResult.SequenceNumber,
+		MD5OfMessage:   md5Hex(body),
+	}, nil
+}
+
+// Create a signed URL that publishes a message to the SNS topic when
+// fetched with GET, without sending the request. The URL carries the
+// same parameters as a Publish of the message, but Publish itself
+// posts them as a form body, so it is not the request Publish makes.
+func (t Topic) PublishURL(c Context, body string) (string, error) {
+	req, err := t.publishRequest(c, body)
+	if err != nil {
+		return "", err
+	}
+
+	return req.URL.String(), nil
+}
+
+// Get the maximum size of a message published to the topic.
+func (t Topic) maxMessageSize() int {
+	if t.MaxMessageSize > 0 {
+		return t.MaxMessageSize
+	}
+
+	return DefaultMaxMessageSize
+}
+
+// Build the parameters of a Publish request.
+func (t Topic) publishParams(body string) (url.Values, error) {
+
+	// SNS counts the UTF-8 encoded size of the message
+	if size, max := len(body), t.maxMessageSize(); size > max {
+		return nil, fmt.Errorf("%w: %d bytes exceeds the limit of %d bytes", ErrMessageTooLarge, size, max)
+	}
+
+	params := make(url.Values)
+	params.Set("TopicArn", t.arn)
+	params.Set("Message", body)
+	params.Set("Action", "Publish")
+	return params, nil
+}
+
+// Build and sign a Publish request.
+func (t Topic) publishRequest(c Context, body string) (*http.Request, error) {
+
+	params, err := t.publishParams(body)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint, err := t.endpoint()
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("GET", endpoint+"?"+params.Encode(), nil)
+	if err != nil {
+		return nil, errors.New("Failed to create request: " + err.Error())
+	}
+
+	if err := c.SignRequest(req); err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
+// Set an attribute on the SNS topic.
+func (t Topic) SetAttribute(c Context, name, value string) error {
+
+	params := make(url.Values)
+	params.Set("TopicArn", t.arn)
+	params.Set("AttributeName", name)
+	params.Set("AttributeValue", value)
+	params.Set("Action", "SetTopicAttributes")
+
+	endpoint, err := t.endpoint()
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("GET", endpoint+"?"+params.Encode(), nil)
+	if err != nil {
+		return errors.New("Failed to create request: " + err.Error())
+	}
+
+	if err := c.SignRequest(req); err != nil {
+		return err
+	}
+
+	return c.call(req, nil)
+}
+
+// Attribute name prefixes for each protocol supporting delivery status
+// logging, keyed by lowercase protocol name.
+var deliveryLoggingProtocols = map[string]string{
+	"application": "Application",
+	"firehose":    "Firehose",
+	"http":        "HTTP",
+	"lambda":      "Lambda",
+	"sqs":         "SQS",
+}
+
+// Enable CloudWatch delivery status logging on the topic for a
+// protocol (one of "application", "firehose", "http", "lambda" or
+// "sqs"). `roleArn` is the IAM role SNS assumes to write logs, and
+// `successSampleRate` is the percentage (0-100) of successful
+// deliveries to log. Failed deliveries are always logged.
+func (t Topic) EnableDeliveryLogging(c Context, protocol, roleArn string, successSampleRate int) error {
+
+	prefix, ok := deliveryLoggingProtocols[strings.ToLower(protocol)]
+	if !ok {
+		return errors.New("Unsupported delivery logging protocol: " + protocol)
+	}
+
+	if successSampleRate < 0 || successSampleRate > 100 {
+		return fmt.Errorf("Success sample rate must be between 0 and 100. Got: %d", successSampleRate)
+	}
+
+	if err := t.SetAttribute(c, prefix+"SuccessFeedbackRoleArn", roleArn); err != nil {
+		return err
+	}
+
+	if err := t.SetAttribute(c, prefix+"SuccessFeedbackSampleRate", strconv.Itoa(successSampleRate)); err != nil {
+		return err
+	}
+
+	return t.SetAttribute(c, prefix+"FailureFeedbackRoleArn", roleArn)
+}
+
+// Get the attributes of the SNS topic.
+func (t Topic) GetAttributes(c Context) (map[string]string, error) {
+
+	params := make(url.Values)
+	params.Set("TopicArn", t.arn)
+	params.Set("Action", "GetTopicAttributes")
+
+	endpoint, err := t.endpoint()
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("GET", endpoint+"?"+params.Encode(), nil)
+	if err != nil {
+		return nil, errors.New("Failed to create request: " + err.Error())
+	}
+
+	if err := c.SignRequest(req); err != nil {
+		return nil, err
+	}
+
+	var response struct {
+		GetTopicAttributesResult struct {
+			Attributes struct {
+				Entry []struct {
+					Key   string `xml:"key"`
+					Value string `xml:"value"`
+				} `xml:"entry"`
+			}
+		}
+	}
+
+	if err := c.call(req, &response); err != nil {
+		return nil, err
+	}
+
+	var attributes map[string]string
+	if len(response.GetTopicAttributesResult.Attributes.Entry) > 0 {
+		attributes = make(map[string]string, len(response.GetTopicAttributesResult.Attributes.Entry))
+	}
+	for _, entry := range response.GetTopicAttributesResult.Attributes.Entry {
+		attributes[entry.Key] = entry.Value
+	}
+
+	return attributes, nil
+}
+
+// Verify the topic is reachable with the given credentials. Failures
+// are returned as a *PingError.
+func (t Topic) Ping(c Context) error {
+	if _, err := t.GetAttributes(c); err != nil {
+		return &PingError{Service: ServiceSNS, Err: err}
+	}
+
+	return nil
+}
+
+// Get the attributes of a subscription to the topic. Errors for
+// deleted or nonexistent subscriptions are returned as an *AWSError
+// with the code "NotFound".
+func (t Topic) GetSubscriptionAttributes(c Context, subscriptionArn string) (map[string]string, error) {
+
+	params := make(url.Values)
+	params.Set("SubscriptionArn", subscriptionArn)
+	params.Set("Action", "GetSubscriptionAttributes")
+
+	endpoint, err := t.endpoint()
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("GET", endpoint+"?"+params.Encode(), nil)
+	if err != nil {
+		return nil, errors.New("Failed to create request: " + err.Error())
+	}
+
+	if err := c.SignRequest(req); err != nil {
+		return nil, err
+	}
+
+	var response struct {
+		GetSubscriptionAttributesResult struct {
+			Attributes struct {
+				Entry []struct {
+					Key   string `xml:"key"`
+					Value string `xml:"value"`
+				} `xml:"entry"`
+			}
+		}
+	}
+
+	if err := c.call(req, &response); err != nil {
+		return nil, err
+	}
+
+	var attributes map[string]string
+	if len(response.GetSubscriptionAttributesResult.Attributes.Entry) > 0 {
+		attributes = make(map[string]string, len(response.GetSubscriptionAttributesResult.Attributes.Entry))
+	}
+	for _, entry := range response.GetSubscriptionAttributesResult.Attributes.Entry {
+		attributes[entry.Key] = entry.Value
+	}
+
+	return attributes, nil
+}
+
+// Set an attribute on a subscription to the topic.
+func (t Topic) SetSubscriptionAttribute(c Context, subscriptionArn, name, value string) error {
+
+	params := make(url.Values)
+	params.Set("SubscriptionArn", subscriptionArn)
+	params.Set("AttributeName", name)
+	params.Set("AttributeValue", value)
+	params.Set("Action", "SetSubscriptionAttributes")
+
+	endpoint, err := t.endpoint()
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("GET", endpoint+"?"+params.Encode(), nil)
+	if err != nil {
+		return errors.New("Failed to create request: " + err.Error())
+	}
+
+	if err := c.SignRequest(req); err != nil {
+		return err
+	}
+
+	return c.call(req, nil)
+}
+
+// Enable or disable raw message delivery for a subscription. With raw
+// delivery enabled, SQS and HTTP endpoints receive the published
+// message as is rather than wrapped in the SNS JSON envelope.
+func (t Topic) SetRawMessageDelivery(c Context, subscriptionArn string, enabled bool) error {
+	return t.SetSubscriptionAttribute(c, subscriptionArn, "RawMessageDelivery", strconv.FormatBool(enabled))
+}
+
+// Send messages that can't be delivered to a subscription to the
+// dead-letter queue `dlq` once SNS gives up retrying. The queue's
+// access policy must allow the topic to send messages to it.
+func (t Topic) SetSubscriptionRedrivePolicy(c Context, subscriptionArn string, dlq Queue) error {
+
+	dlqArn, err := dlq.arn(c)
+	if err != nil {
+		return err
+	}
+
+	policy, err := json.Marshal(struct {
+		DeadLetterTargetArn string `json:"deadLetterTargetArn"`
+	}{dlqArn})
+	if err != nil {
+		return errors.New("Failed to encode redrive policy: " + err.Error())
 	}
 
-	return response.PublishResult.MessageId, response.ResponseMetadata.RequestId, nil
+	return t.SetSubscriptionAttribute(c, subscriptionArn, "RedrivePolicy", string(policy))
 }
@@ -0,0 +1,227 @@
+// Copyright 2012 Matthew Endsley
+// All rights reserved
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted providing that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+// STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+// IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package goaws
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Start a server answering every request with `body` and create a topic
+// sending its requests there. Returns the topic and the request count.
+func newTestSNSServer(t *testing.T, body string) (Topic, *int) {
+
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+
+	topic, err := NewTopic("sns.us-east-1.amazonaws.com", "arn:aws:sns:us-east-1:123456789012:topic").UseLocal(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return topic, &requests
+}
+
+// Create a message whose body and attributes total `size` bytes.
+func newSizedInput(size int) PublishInput {
+	attrs := MessageAttributes{}
+	attrs.SetString("attr", strings.Repeat("v", 1024))
+	return PublishInput{
+		Message:           strings.Repeat("m", size-len("attr")-len("String")-1024),
+		MessageAttributes: attrs,
+	}
+}
+
+func TestPublishMessageSizeLimit(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		max     int
+		size    int
+		tooLong bool
+	}{
+		{"at the limit", 0, DefaultMaxMessageSize, false},
+		{"one byte over", 0, DefaultMaxMessageSize + 1, true},
+		{"at a custom limit", 4096, 4096, false},
+		{"over a custom limit", 4096, 4097, true},
+	}
+
+	for _, tt := range tests {
+		topic, requests := newTestSNSServer(t, `<PublishResponse><PublishResult><MessageId>message-id</MessageId></PublishResult></PublishResponse>`)
+		topic.MaxMessageSize = tt.max
+		_, err := topic.PublishMessage(NewContext("id", "key"), newSizedInput(tt.size))
+
+		if tt.tooLong {
+			if !errors.Is(err, ErrMessageTooLarge) {
+				t.Errorf("%s: error = %v, want ErrMessageTooLarge", tt.name, err)
+			}
+			if *requests != 0 {
+				t.Errorf("%s: oversized message was sent", tt.name)
+			}
+		} else if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+		}
+	}
+}
+
+func TestPublishBatchSizeLimit(t *testing.T) {
+
+	half := DefaultMaxMessageSize / 2
+	tests := []struct {
+		name    string
+		sizes   []int
+		tooLong bool
+	}{
+		{"at the limit", []int{half, half}, false},
+		{"one byte over", []int{half, half + 1}, true},
+		{"entry over the limit", []int{DefaultMaxMessageSize + 1}, true},
+	}
+
+	for _, tt := range tests {
+		topic, requests := newTestSNSServer(t, `<PublishBatchResponse><PublishBatchResult><Successful/><Failed/></PublishBatchResult></PublishBatchResponse>`)
+
+		var inputs []PublishInput
+		for _, size := range tt.sizes {
+			inputs = append(inputs, newSizedInput(size))
+		}
+		_, _, err := topic.PublishBatch(NewContext("id", "key"), inputs)
+
+		if tt.tooLong {
+			if !errors.Is(err, ErrMessageTooLarge) {
+				t.Errorf("%s: error = %v, want ErrMessageTooLarge", tt.name, err)
+			}
+			if *requests != 0 {
+				t.Errorf("%s: oversized batch was sent", tt.name)
+			}
+		} else if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+		}
+	}
+}
+
+func TestNewTopicFromARN(t *testing.T) {
+
+	tests := []struct {
+		name string
+		arn  string
+		host string
+		err  bool
+	}{
+		{"aws", "arn:aws:sns:us-east-1:123456789012:topic", "sns.us-east-1.amazonaws.com", false},
+		{"fifo", "arn:aws:sns:eu-west-1:123456789012:topic.fifo", "sns.eu-west-1.amazonaws.com", false},
+		{"aws-cn", "arn:aws-cn:sns:cn-north-1:123456789012:topic", "sns.cn-north-1.amazonaws.com.cn", false},
+		{"aws-us-gov", "arn:aws-us-gov:sns:us-gov-west-1:123456789012:topic", "sns.us-gov-west-1.amazonaws.com", false},
+		{"empty", "", "", true},
+		{"not an ARN", "sns.us-east-1.amazonaws.com", "", true},
+		{"too few parts", "arn:aws:sns:us-east-1:topic", "", true},
+		{"SQS queue", "arn:aws:sqs:us-east-1:123456789012:queue", "", true},
+		{"no region", "arn:aws:sns::123456789012:topic", "", true},
+		{"no account", "arn:aws:sns:us-east-1::topic", "", true},
+		{"no name", "arn:aws:sns:us-east-1:123456789012:", "", true},
+		{"subscription", "arn:aws:sns:us-east-1:123456789012:topic:8a21d249-4329-4871-acc6-7be709c6ea7f", "", true},
+	}
+
+	for _, tt := range tests {
+		topic, err := NewTopicFromARN(tt.arn)
+
+		if tt.err {
+			if err == nil {
+				t.Errorf("%s: accepted, host %q", tt.name, topic.Host())
+			}
+		} else if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+		} else if topic.Host() != tt.host || topic.ARN() != tt.arn {
+			t.Errorf("%s: host = %q, ARN = %q, want %q", tt.name, topic.Host(), topic.ARN(), tt.host)
+		}
+	}
+}
+
+func TestCreateExisting(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		status   int
+		response string
+		create   func(c Context) error
+		mismatch bool
+	}{
+		{"same topic", http.StatusOK,
+			`<CreateTopicResponse><CreateTopicResult><TopicArn>arn:aws:sns:us-east-1:123456789012:topic</TopicArn></CreateTopicResult></CreateTopicResponse>`,
+			func(c Context) error {
+				topic, err := CreateTopic(c, "sns.us-east-1.amazonaws.com", "topic", map[string]string{"DisplayName": "Topic"})
+				if err == nil && topic.ARN() != "arn:aws:sns:us-east-1:123456789012:topic" {
+					t.Errorf("same topic: ARN = %s", topic.ARN())
+				}
+				return err
+			}, false},
+		{"topic with different attributes", http.StatusBadRequest,
+			`<ErrorResponse><Error><Type>Sender</Type><Code>InvalidParameter</Code><Message>Invalid parameter: Attributes Reason: Topic already exists with different attributes</Message></Error></ErrorResponse>`,
+			func(c Context) error {
+				_, err := CreateTopic(c, "sns.us-east-1.amazonaws.com", "topic", map[string]string{"DisplayName": "Other"})
+				return err
+			}, false},
+		{"queue with different attributes", http.StatusBadRequest,
+			`<ErrorResponse><Error><Type>Sender</Type><Code>QueueAlreadyExists</Code><Message>A queue already exists with the same name and a different value for attribute VisibilityTimeout</Message></Error></ErrorResponse>`,
+			func(c Context) error {
+				_, err := CreateQueue(c, "https://sqs.us-east-1.amazonaws.com", "queue", QueueConfig{})
+				return err
+			}, true},
+	}
+
+	for _, tt := range tests {
+		c := NewContext("id", "key")
+		c.Transport = roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			return &http.Response{
+				StatusCode: tt.status,
+				Body:       io.NopCloser(strings.NewReader(tt.response)),
+				Request:    r,
+			}, nil
+		})
+
+		err := tt.create(c)
+		if tt.status == http.StatusOK {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", tt.name, err)
+			}
+			continue
+		}
+
+		var awsErr *AWSError
+		if !errors.As(err, &awsErr) {
+			t.Errorf("%s: error = %v, want an *AWSError", tt.name, err)
+		}
+		if errors.Is(err, ErrAttributesMismatch) != tt.mismatch {
+			t.Errorf("%s: error = %v, ErrAttributesMismatch = %v", tt.name, err, !tt.mismatch)
+		}
+	}
+}
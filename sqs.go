@@ -25,12 +25,15 @@
 package goaws
 
 import (
+	"context"
 	"encoding/xml"
 	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -39,64 +42,273 @@ type Queue struct {
 	url string
 }
 
-// Create a SQS queue given it's URL.
+// Create a SQS queue given it's URL. URLs without a scheme are assumed
+// to use https, and trailing slashes are ignored.
 func NewQueue(url string) Queue {
 	return Queue{
-		url: url,
+		url: normalizeQueueURL(url),
 	}
 }
 
+// Get the URL of the queue, e.g. to persist it for a later NewQueue.
+// Queues using a local endpoint (see UseLocal) report its URL.
+func (q Queue) URL() string {
+	return q.url
+}
+
+// Normalize a queue URL so request URLs can be built by appending to it.
+func normalizeQueueURL(queueURL string) string {
+	if !strings.Contains(queueURL, "://") {
+		queueURL = "https://" + queueURL
+	}
+
+	return strings.TrimRight(queueURL, "/")
+}
+
+// Errors returned when a parameter fails validation before a request is
+// sent. They are wrapped with details of the failure, and can be
+// matched with errors.Is.
+var (
+	ErrMaxMessagesRange       = errors.New("Max messages out of range")
+	ErrWaitTimeRange          = errors.New("Wait time out of range")
+	ErrVisibilityTimeoutRange = errors.New("Visibility timeout out of range")
+	ErrBatchTooLarge          = errors.New("Batch too large")
+	ErrInvalidFIFOToken       = errors.New("Invalid FIFO token")
+)
+
+// Create a copy of the queue whose requests are sent to a local
+// endpoint, such as "http://localhost:4566" for localstack, instead of
+// SQS. The queue URL's path (account and queue name) is kept.
+func (q Queue) UseLocal(endpoint string) (Queue, error) {
+
+	local, err := url.Parse(endpoint)
+	if err != nil || local.Scheme == "" || local.Host == "" {
+		return Queue{}, errors.New("Malformed local endpoint: " + endpoint)
+	}
+
+	u, err := url.Parse(q.url)
+	if err != nil {
+		return Queue{}, errors.New("Malformed queue URL: " + err.Error())
+	}
+
+	u.Scheme = local.Scheme
+	u.Host = local.Host
+	q.url = u.String()
+	return q, nil
+}
+
+// Is the queue a FIFO queue?
+func (q Queue) isFIFO() bool {
+	return strings.HasSuffix(q.url, ".fifo")
+}
+
+// Validate a FIFO token such as a receive request attempt id or a
+// message group id. Tokens are at most 128 characters of alphanumerics
+// and punctuation.
+func validateFIFOToken(name, id string) error {
+	if len(id) > 128 {
+		return fmt.Errorf("%w: %s must be no longer than 128 characters. Got: %d", ErrInvalidFIFOToken, name, len(id))
+	}
+
+	for _, ch := range id {
+		if ch < '!' || ch > '~' {
+			return fmt.Errorf("%w: %s contains an invalid character: %q", ErrInvalidFIFOToken, name, ch)
+		}
+	}
+
+	return nil
+}
+
 type SQSMessage struct {
-	ReceiptHandle string
-	Body          string
+	MessageId         string
+	ReceiptHandle     string
+	Body              string
+	MessageAttributes MessageAttributes
+
+	// System attributes of the message (e.g. "SentTimestamp" or
+	// "AWSTraceHeader"), kept apart from the user's MessageAttributes.
+	// Only received when requested through the receive's
+	// AttributeNames.
+	SystemAttributes map[string]string
+
+	// X-Ray trace header propagated through the AWSTraceHeader system
+	// attribute. Only received when requested through the receive's
+	// AttributeNames.
+	AWSTraceHeader string
+}
+
+// Get the external id attached by Topic.PublishWithId to a message
+// delivered with raw message delivery, or an empty string if the
+// message doesn't carry one. The attribute must be requested through
+// the receive's MessageAttributeNames. Use UnwrapSNS and
+// SNSNotification.ExternalId for enveloped notifications.
+func (m SQSMessage) ExternalId() string {
+	attr, ok := m.MessageAttributes[ExternalIdAttribute]
+	if !ok || attr.DataType != "String" {
+		return ""
+	}
+
+	return attr.StringValue
+}
+
+// Maximum number of messages SQS returns from a single receive.
+const MaxReceiveMessages = 10
+
+// Options controlling a receive from an SQS queue.
+type ReceiveOptions struct {
+	// Maximum number of messages to receive.
+	MaxMessages int
+
+	// Whether to short or long poll. By default a zero Wait short
+	// polls and any other Wait long polls.
+	Mode ReceiveMode
+
+	// Maximum time to wait for messages to arrive.
+	Wait time.Duration
+
+	// Token used to deduplicate retried receive calls on FIFO
+	// queues. If a receive fails with a networking error, retrying
+	// with the same attempt id within the 5 minute deduplication
+	// window returns the same set of messages, even if their
+	// visibility timeout has not yet expired. Ignored for non-FIFO
+	// queues.
+	ReceiveRequestAttemptId string
+
+	// Names of the message attributes to receive. Use "All" to
+	// receive every attribute.
+	MessageAttributeNames []string
+
+	// Names of the system attributes to receive (e.g.
+	// "AWSTraceHeader"). Use "All" to receive every attribute.
+	AttributeNames []string
+
+	// Time received messages are hidden from other consumers. If nil,
+	// a visibility timeout of 5 seconds is used.
+	//
+	// A timeout of zero (e.g. `new(time.Duration)`) peeks at messages
+	// without locking them: they remain immediately visible to, and
+	// may be received by, other consumers.
+	VisibilityTimeout *time.Duration
+
+	// Omit the VisibilityTimeout parameter from the request, so the
+	// queue's own default visibility timeout applies. Takes
+	// precedence over VisibilityTimeout.
+	OmitVisibilityTimeout bool
+
+	// Skip verifying received messages against the MD5 digests of
+	// their bodies and attributes returned by SQS. Verification is on
+	// by default and fails the receive with ErrMD5Mismatch if a message
+	// was corrupted in transit. Hashing every body costs throughput
+	// for large messages, so consumers that trust the transport (TLS
+	// already protects message integrity) may skip it.
+	SkipMD5Verification bool
+
+	// Handle for aborting the receive from another goroutine, if set.
+	// A cancelled receive returns ErrPollCancelled, which also stops
+	// Consume and Handle.
+	Canceller *PollCanceller
+}
+
+// How a receive polls the queue.
+//
+// A short poll returns immediately, and samples only a subset of the
+// servers holding the queue: it may return no messages even though
+// the queue isn't empty, so an empty short poll must not be taken to
+// mean the queue is drained. A long poll queries every server and
+// waits up to its wait time for messages to arrive, so it only comes
+// back empty if no messages were available for the whole wait.
+type ReceiveMode int
+
+const (
+	// Short poll if the receive's Wait is zero, otherwise long poll.
+	ReceiveWaitDefault ReceiveMode = iota
+
+	// Short poll. The receive's Wait must be zero.
+	ShortPoll
+
+	// Long poll for the receive's Wait, or 20 seconds if zero.
+	LongPoll
+)
+
+// Longest wait time supported by a long poll.
+const maxLongPollWait = 20 * time.Second
+
+// Get the time a receive waits for messages.
+func (opts ReceiveOptions) wait() time.Duration {
+	if opts.Mode == LongPoll && opts.Wait == 0 {
+		return maxLongPollWait
+	}
+
+	return opts.Wait
 }
 
+// Visibility timeout used when a receive doesn't specify one.
+const defaultVisibilityTimeout = 5 * time.Second
+
 // Recieves messages from the SQS queue using the specified context to
 // sign the reques. Retreives at most `max` messages waiting at most
-// the duration specified by `wait`.
+// the duration specified by `wait`. A zero `wait` short polls, which
+// may return no messages even if the queue isn't empty; see
+// ReceiveMode.
 func (q Queue) ReceiveMessages(c Context, max int, wait time.Duration) (messages []SQSMessage, err error) {
+	return q.ReceiveMessagesWithOptions(c, ReceiveOptions{
+		MaxMessages: max,
+		Wait:        wait,
+	})
+}
 
-	seconds := int(wait.Seconds())
-	if seconds < 0 || seconds > 20 {
-		return nil, fmt.Errorf("Wait time must be no longer than 20 seconds. Got: %d", seconds)
-	}
+// Recieves messages from the SQS queue using the specified context to
+// sign the request and the specified receive options.
+func (q Queue) ReceiveMessagesWithOptions(c Context, opts ReceiveOptions) (messages []SQSMessage, err error) {
+	return q.receive(c.context(), c, opts)
+}
 
-	if max < 0 || max > 10 {
-		return nil, fmt.Errorf("Max messages must be no larger than 10. Got: %d", max)
+// Receive messages from the queue, aborting if `ctx` is cancelled.
+func (q Queue) receive(ctx context.Context, c Context, opts ReceiveOptions) (messages []SQSMessage, err error) {
+
+	req, err := q.receiveRequest(c, opts)
+	if err != nil {
+		return nil, err
 	}
 
-	params := make(url.Values)
-	params.Set("Action", "ReceiveMessage")
-	params.Set("MaxNumberOfMessages", strconv.FormatInt(int64(max), 10))
-	params.Set("VisibilityTimeout", "5")
-	params.Set("WaitTimeSeconds", strconv.FormatInt(int64(seconds), 10))
-	params.Set("Version", "2009-02-01")
+	if opts.Canceller != nil {
+		watched, cancelled, stop := opts.Canceller.watch(ctx)
+		defer stop()
 
-	req, err := http.NewRequest("GET", q.url+"/?"+params.Encode(), nil)
-	if err != nil {
-		return nil, errors.New("Failed to create request: " + err.Error())
+		ctx = watched
+		defer func() {
+			if err != nil && cancelled() {
+				messages, err = nil, ErrPollCancelled
+			}
+		}()
 	}
 
-	c.SignRequest(req)
+	req = req.WithContext(ctx)
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := c.do(req, opts.wait())
 	if err != nil {
-		return nil, errors.New("Failed to do request: " + err.Error())
+		return nil, fmt.Errorf("Failed to do request: %w", err)
 	}
 
-	defer resp.Body.Close()
+	defer closeBody(resp)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, decodeError(resp)
+	}
 
 	var response struct {
 		ReceiveMessageResult struct {
 			Message []struct {
-				MessageId     string
-				ReceiptHandle string
-				MD5OfBody     string
-				Body          string
-				Attribute     []struct {
+				MessageId              string
+				ReceiptHandle          string
+				MD5OfBody              string
+				Body                   string
+				MD5OfMessageAttributes string
+				Attribute              []struct {
 					Name  string
 					Value string
 				}
+				MessageAttribute []messageAttributeXML
 			}
 		}
 		ResponseMetadata struct {
@@ -112,8 +324,32 @@ func (q Queue) ReceiveMessages(c Context, max int, wait time.Duration) (messages
 	if count > 0 {
 		messages = make([]SQSMessage, count)
 		for ii, msg := range response.ReceiveMessageResult.Message {
+			messages[ii].MessageId = msg.MessageId
 			messages[ii].ReceiptHandle = msg.ReceiptHandle
 			messages[ii].Body = msg.Body
+			if len(msg.Attribute) > 0 {
+				messages[ii].SystemAttributes = make(map[string]string, len(msg.Attribute))
+			}
+			for _, attr := range msg.Attribute {
+				messages[ii].SystemAttributes[attr.Name] = attr.Value
+			}
+			messages[ii].AWSTraceHeader = messages[ii].SystemAttributes["AWSTraceHeader"]
+			messages[ii].MessageAttributes, err = parseMessageAttributes(msg.MessageAttribute)
+			if err != nil {
+				return nil, errors.New("Malformed response: " + err.Error())
+			}
+
+			if !opts.SkipMD5Verification {
+				if err := verifyMD5("body of message "+msg.MessageId, md5Hex(msg.Body), msg.MD5OfBody); err != nil {
+					return nil, err
+				}
+
+				if len(messages[ii].MessageAttributes) > 0 {
+					if err := verifyMD5("attributes of message "+msg.MessageId, messages[ii].MessageAttributes.md5(), msg.MD5OfMessageAttributes); err != nil {
+						return nil, err
+					}
+				}
+			}
 		}
 	}
 
@@ -121,25 +357,895 @@ func (q Queue) ReceiveMessages(c Context, max int, wait time.Duration) (messages
 	return
 }
 
-// Delete a message from the queue.
+// Backoff applied between empty polls by WaitForMessages. The delay
+// grows by the step after each empty poll up to the maximum.
+const (
+	emptyPollBackoffStep = 250 * time.Millisecond
+	emptyPollBackoffMax  = 5 * time.Second
+)
+
+// Poll the queue until at least one message is received or `ctx` is
+// cancelled. Each poll long-polls for `opts.Wait` (20 seconds if
+// zero) unless the options select ShortPoll, and empty polls are
+// followed by a short, increasing delay before polling again.
+func (q Queue) WaitForMessages(ctx context.Context, c Context, opts ReceiveOptions) ([]SQSMessage, error) {
+
+	if opts.Mode == ReceiveWaitDefault {
+		opts.Mode = LongPoll
+	}
+
+	var delay time.Duration
+	for {
+		messages, err := q.receive(ctx, c, opts)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		} else if err != nil {
+			return nil, err
+		} else if len(messages) > 0 {
+			return messages, nil
+		}
+
+		if delay < emptyPollBackoffMax {
+			delay += emptyPollBackoffStep
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// Backoff between receives retried by ReceiveSupervised.
+var supervisorBackoff = RetryPolicy{
+	BaseDelay: time.Second,
+	MaxDelay:  time.Minute,
+	Jitter:    JitterEqual,
+}
+
+// Receive messages from the queue, retrying transient failures (see
+// IsTransient) with backoff until a receive succeeds or `ctx` is
+// cancelled. Other failures are returned immediately. `onTransient`, if
+// not nil, is called with each transient failure before retrying.
+func (q Queue) ReceiveSupervised(ctx context.Context, c Context, opts ReceiveOptions, onTransient func(error)) ([]SQSMessage, error) {
+
+	for retry := 0; ; retry++ {
+		messages, err := q.receive(ctx, c, opts)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		} else if err == nil || !IsTransient(err) {
+			return messages, err
+		}
+
+		if onTransient != nil {
+			onTransient(err)
+		}
+
+		timer := time.NewTimer(supervisorBackoff.backoff(retry))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// Create the signed URL for a receive from the SQS queue without
+// sending the request.
+func (q Queue) ReceiveMessagesURL(c Context, opts ReceiveOptions) (string, error) {
+	req, err := q.receiveRequest(c, opts)
+	if err != nil {
+		return "", err
+	}
+
+	return req.URL.String(), nil
+}
+
+// Build and sign a ReceiveMessage request.
+func (q Queue) receiveRequest(c Context, opts ReceiveOptions) (*http.Request, error) {
+
+	max := opts.MaxMessages
+	if opts.Mode == ShortPoll && opts.Wait != 0 {
+		return nil, fmt.Errorf("%w: short polls can't wait. Got: %v", ErrWaitTimeRange, opts.Wait)
+	}
+
+	seconds := int(opts.wait().Seconds())
+	if seconds < 0 || seconds > 20 {
+		return nil, fmt.Errorf("%w: must be no longer than 20 seconds. Got: %d", ErrWaitTimeRange, seconds)
+	}
+
+	if max < 0 || max > MaxReceiveMessages {
+		return nil, fmt.Errorf("%w: must be between 0 and %d. Got: %d", ErrMaxMessagesRange, MaxReceiveMessages, max)
+	}
+
+	if err := validateFIFOToken("Receive request attempt id", opts.ReceiveRequestAttemptId); err != nil {
+		return nil, err
+	}
+
+	visibility := defaultVisibilityTimeout
+	if opts.VisibilityTimeout != nil {
+		visibility = *opts.VisibilityTimeout
+	}
+
+	visibilitySeconds := int(visibility.Seconds())
+	if visibilitySeconds < 0 || visibilitySeconds > 43200 {
+		return nil, fmt.Errorf("%w: must be no longer than 12 hours. Got: %d", ErrVisibilityTimeoutRange, visibilitySeconds)
+	}
+
+	params := make(url.Values)
+	params.Set("Action", "ReceiveMessage")
+	params.Set("MaxNumberOfMessages", strconv.FormatInt(int64(max), 10))
+	if !opts.OmitVisibilityTimeout {
+		params.Set("VisibilityTimeout", strconv.Itoa(visibilitySeconds))
+	}
+	params.Set("WaitTimeSeconds", strconv.FormatInt(int64(seconds), 10))
+	params.Set("Version", "2012-11-05")
+	if opts.ReceiveRequestAttemptId != "" && q.isFIFO() {
+		params.Set("ReceiveRequestAttemptId", opts.ReceiveRequestAttemptId)
+	}
+	for ii, name := range opts.MessageAttributeNames {
+		params.Set("MessageAttributeName."+strconv.Itoa(ii+1), name)
+	}
+	for ii, name := range opts.AttributeNames {
+		params.Set("AttributeName."+strconv.Itoa(ii+1), name)
+	}
+
+	req, err := http.NewRequest("GET", q.url+"/?"+params.Encode(), nil)
+	if err != nil {
+		return nil, errors.New("Failed to create request: " + err.Error())
+	}
+
+	if err := c.SignRequest(req); err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
+// A message to send to an SQS queue.
+type SendMessageInput struct {
+	Body              string
+	MessageAttributes MessageAttributes
+
+	// Ordering group of the message. Required for FIFO queues.
+	MessageGroupId string
+
+	// Token used to deduplicate sends to a FIFO queue within the
+	// 5 minute deduplication interval. Optional when the queue uses
+	// content based deduplication.
+	MessageDeduplicationId string
+
+	// X-Ray trace header to propagate with the message, sent as the
+	// AWSTraceHeader system attribute.
+	AWSTraceHeader string
+}
+
+// Result of sending a message to an SQS queue.
+type SendMessageResult struct {
+	MessageId        string
+	RequestId        string
+	MD5OfMessageBody string
+
+	// Digest of the message attributes. Empty if the message was sent
+	// without attributes.
+	MD5OfMessageAttributes string
+
+	// Digest of the message system attributes (such as the
+	// AWSTraceHeader). Empty if the message was sent without system
+	// attributes.
+	MD5OfMessageSystemAttributes string
+
+	// Sequence number assigned to a message sent to a FIFO queue.
+	//
+	// SQS doesn't report whether a FIFO send was dropped as a
+	// duplicate: a deduplicated send succeeds and returns the
+	// MessageId and SequenceNumber of the original message. Callers
+	// can detect repeats by comparing these with earlier sends.
+	SequenceNumber string
+}
+
+// Returned when the MD5 digest reported by SQS doesn't match the
+// digest of the submitted message, indicating corruption in transit.
+// The message may not have been stored correctly, and it is safe to
+// send it again.
+var ErrMD5Mismatch = errors.New("MD5 mismatch")
+
+// Verify the digest reported by SQS for `what` against the expected
+// digest.
+func verifyMD5(what, expected, actual string) error {
+	if !strings.EqualFold(expected, actual) {
+		return fmt.Errorf("%w for %s: expected %s, got %s", ErrMD5Mismatch, what, expected, actual)
+	}
+
+	return nil
+}
+
+// Verify the digests returned by SQS for a sent message.
+func (msg SendMessageInput) verify(result SendMessageResult) error {
+
+	if err := verifyMD5("message body", md5Hex(msg.Body), result.MD5OfMessageBody); err != nil {
+		return err
+	}
+
+	if len(msg.MessageAttributes) > 0 {
+		if err := verifyMD5("message attributes", msg.MessageAttributes.md5(), result.MD5OfMessageAttributes); err != nil {
+			return err
+		}
+	}
+
+	if system := msg.systemAttributes(); len(system) > 0 {
+		if err := verifyMD5("message system attributes", system.md5(), result.MD5OfMessageSystemAttributes); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Send a message to the SQS queue using the specified context to sign
+// the request. Returns the id assigned to the message.
+func (q Queue) SendMessage(c Context, body string) (messageId string, err error) {
+	result, err := q.Send(c, SendMessageInput{Body: body})
+	if err != nil {
+		return "", err
+	}
+
+	return result.MessageId, nil
+}
+
+// Send a message, including its attributes, to the SQS queue using the
+// specified context to sign the request. The digests of the body,
+// attributes and system attributes returned by SQS are verified, and
+// ErrMD5Mismatch is returned if they don't match the submitted message.
+func (q Queue) Send(c Context, msg SendMessageInput) (SendMessageResult, error) {
+
+	req, err := c.newPostRequest(q.url+"/", q.sendParams(msg))
+	if err != nil {
+		return SendMessageResult{}, err
+	}
+
+	var response struct {
+		SendMessageResult SendMessageResult
+		ResponseMetadata  struct {
+			RequestId string
+		}
+	}
+
+	if err := c.call(req, &response); err != nil {
+		return SendMessageResult{}, err
+	}
+
+	result := response.SendMessageResult
+	result.RequestId = response.ResponseMetadata.RequestId
+	if err := msg.verify(result); err != nil {
+		return SendMessageResult{}, err
+	}
+
+	return result, nil
+}
+
+// Send up to 10 messages to the SQS queue in a single request. Returns
+// a result for each message, in order, and a map of message index to
+// error for each message that could not be sent. Failures reported by
+// SQS are *AWSError values. Results of failed messages are zero values.
+// Digests are verified as for Send, and mismatches are reported as
+// failures.
+func (q Queue) SendMessageBatch(c Context, msgs []SendMessageInput) ([]SendMessageResult, map[int]error, error) {
+
+	results, errs, err := q.sendBatch(c.context(), c, msgs)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var failed map[int]error
+	for ii, err := range errs {
+		if err == nil {
+			continue
+		}
+
+		if failed == nil {
+			failed = make(map[int]error)
+		}
+		failed[ii] = err
+	}
+
+	return results, failed, nil
+}
+
+// Send a batch of messages bound to `ctx`. Returns a result and an
+// error for each message.
+func (q Queue) sendBatch(ctx context.Context, c Context, msgs []SendMessageInput) ([]SendMessageResult, []error, error) {
+
+	if len(msgs) == 0 {
+		return nil, nil, errors.New("Batch must contain at least one entry")
+	} else if len(msgs) > maxBatchEntries {
+		return nil, nil, fmt.Errorf("%w: must contain no more than %d entries. Got: %d", ErrBatchTooLarge, maxBatchEntries, len(msgs))
+	}
+
+	params := make(url.Values)
+	params.Set("Action", "SendMessageBatch")
+	params.Set("Version", "2012-11-05")
+	for ii, msg := range msgs {
+		prefix := "SendMessageBatchRequestEntry." + strconv.Itoa(ii+1) + "."
+		params.Set(prefix+"Id", strconv.Itoa(ii))
+		msg.encode(params, prefix)
+	}
+
+	req, err := c.newPostRequest(q.url+"/", params)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var response struct {
+		SendMessageBatchResult struct {
+			SendMessageBatchResultEntry []struct {
+				Id string
+				SendMessageResult
+			}
+			BatchResultErrorEntry []struct {
+				Id          string
+				Code        string
+				Message     string
+				SenderFault bool
+			}
+		}
+		ResponseMetadata struct {
+			RequestId string
+		}
+	}
+
+	if err := c.call(req.WithContext(ctx), &response); err != nil {
+		return nil, nil, err
+	}
+
+	entryIndex := func(id string) (int, error) {
+		ii, err := strconv.Atoi(id)
+		if err != nil || ii < 0 || ii >= len(msgs) {
+			return 0, errors.New("Malformed response: unknown batch entry id " + id)
+		}
+
+		return ii, nil
+	}
+
+	requestId := response.ResponseMetadata.RequestId
+	results := make([]SendMessageResult, len(msgs))
+	errs := make([]error, len(msgs))
+	reported := make([]bool, len(msgs))
+	for _, entry := range response.SendMessageBatchResult.SendMessageBatchResultEntry {
+		ii, err := entryIndex(entry.Id)
+		if err != nil {
+			return nil, nil, err
+		}
+		reported[ii] = true
+
+		result := entry.SendMessageResult
+		result.RequestId = requestId
+		if err := msgs[ii].verify(result); err != nil {
+			errs[ii] = err
+			continue
+		}
+
+		results[ii] = result
+	}
+
+	for _, entry := range response.SendMessageBatchResult.BatchResultErrorEntry {
+		ii, err := entryIndex(entry.Id)
+		if err != nil {
+			return nil, nil, err
+		}
+		reported[ii] = true
+
+		faultType := "Receiver"
+		if entry.SenderFault {
+			faultType = "Sender"
+		}
+
+		errs[ii] = &AWSError{
+			Type:      faultType,
+			Code:      entry.Code,
+			Message:   entry.Message,
+			RequestId: requestId,
+		}
+	}
+
+	// SQS reports every entry; one missing from the response was not
+	// confirmed as sent
+	for ii := range msgs {
+		if !reported[ii] {
+			errs[ii] = errors.New("Malformed response: no result for batch entry " + strconv.Itoa(ii))
+		}
+	}
+
+	return results, errs, nil
+}
+
+// Create a signed URL that sends a message to the SQS queue when
+// fetched with GET, without sending the request. The URL carries the
+// same parameters as a Send of the message, but Send itself posts them
+// as a form body, so it is not the request Send makes.
+func (q Queue) SendMessageURL(c Context, msg SendMessageInput) (string, error) {
+	req, err := q.sendRequest(c, msg)
+	if err != nil {
+		return "", err
+	}
+
+	return req.URL.String(), nil
+}
+
+// Build the parameters of a SendMessage request.
+func (q Queue) sendParams(msg SendMessageInput) url.Values {
+
+	params := make(url.Values)
+	params.Set("Action", "SendMessage")
+	params.Set("Version", "2012-11-05")
+	msg.encode(params, "")
+	return params
+}
+
+// Add the message fields to request parameters, each name prefixed
+// with `prefix`.
+func (msg SendMessageInput) encode(params url.Values, prefix string) {
+	params.Set(prefix+"MessageBody", msg.Body)
+	msg.MessageAttributes.encode(params, prefix+"MessageAttribute")
+	if msg.MessageGroupId != "" {
+		params.Set(prefix+"MessageGroupId", msg.MessageGroupId)
+	}
+	if msg.MessageDeduplicationId != "" {
+		params.Set(prefix+"MessageDeduplicationId", msg.MessageDeduplicationId)
+	}
+	msg.systemAttributes().encode(params, prefix+"MessageSystemAttribute")
+}
+
+// Get the system attributes sent with the message.
+func (msg SendMessageInput) systemAttributes() MessageAttributes {
+	if msg.AWSTraceHeader == "" {
+		return nil
+	}
+
+	system := make(MessageAttributes)
+	system.SetString("AWSTraceHeader", msg.AWSTraceHeader)
+	return system
+}
+
+// Build and sign a SendMessage request.
+func (q Queue) sendRequest(c Context, msg SendMessageInput) (*http.Request, error) {
+
+	params := q.sendParams(msg)
+
+	req, err := http.NewRequest("GET", q.url+"/?"+params.Encode(), nil)
+	if err != nil {
+		return nil, errors.New("Failed to create request: " + err.Error())
+	}
+
+	if err := c.SignRequest(req); err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
+// Delete a message from the queue. Service errors are returned as an
+// *AWSError.
 func (q Queue) DeleteMessage(c Context, receiptHandle string) error {
 
 	params := make(url.Values)
 	params.Set("Action", "DeleteMessage")
 	params.Set("ReceiptHandle", receiptHandle)
-	params.Set("Version", "2009-02-01")
+	params.Set("Version", "2012-11-05")
 
 	req, err := http.NewRequest("GET", q.url+"/?"+params.Encode(), nil)
 	if err != nil {
 		return errors.New("Failed to create request: " + err.Error())
 	}
 
-	c.SignRequest(req)
+	if err := c.SignRequest(req); err != nil {
+		return err
+	}
+
+	return c.call(req, nil)
+}
+
+// Delete a received message from the queue. Errors identify the
+// message by its MessageId.
+func (q Queue) DeleteReceived(c Context, m SQSMessage) error {
+	if m.ReceiptHandle == "" {
+		return errors.New("Message " + m.MessageId + " has no receipt handle")
+	}
+
+	if err := q.DeleteMessage(c, m.ReceiptHandle); err != nil {
+		return fmt.Errorf("Failed to delete message %s: %w", m.MessageId, err)
+	}
+
+	return nil
+}
+
+// Maximum number of entries in a single SQS batch request.
+const maxBatchEntries = 10
+
+// Delete up to 10 messages from the queue in a single request. Returns
+// an error for each message that could not be deleted, keyed by receipt
+// handle. Per-message errors are *AWSError values whose Type is
+// "Sender" or "Receiver", so they can be classified with IsTransient.
+func (q Queue) DeleteMessageBatch(c Context, receiptHandles []string) (failed map[string]error, err error) {
+
+	if len(receiptHandles) > maxBatchEntries {
+		return nil, fmt.Errorf("%w: must contain no more than %d entries. Got: %d", ErrBatchTooLarge, maxBatchEntries, len(receiptHandles))
+	}
+
+	params := make(url.Values)
+	params.Set("Action", "DeleteMessageBatch")
+	params.Set("Version", "2012-11-05")
+	for ii, handle := range receiptHandles {
+		prefix := "DeleteMessageBatchRequestEntry." + strconv.Itoa(ii+1)
+		params.Set(prefix+".Id", strconv.Itoa(ii))
+		params.Set(prefix+".ReceiptHandle", handle)
+	}
+
+	req, err := http.NewRequest("GET", q.url+"/?"+params.Encode(), nil)
+	if err != nil {
+		return nil, errors.New("Failed to create request: " + err.Error())
+	}
+
+	if err := c.SignRequest(req); err != nil {
+		return nil, err
+	}
+
+	var response struct {
+		DeleteMessageBatchResult struct {
+			BatchResultErrorEntry []struct {
+				Id          string
+				Code        string
+				Message     string
+				SenderFault bool
+			}
+		}
+		ResponseMetadata struct {
+			RequestId string
+		}
+	}
+
+	if err := c.call(req, &response); err != nil {
+		return nil, err
+	}
+
+	for _, entry := range response.DeleteMessageBatchResult.BatchResultErrorEntry {
+		ii, err := strconv.Atoi(entry.Id)
+		if err != nil || ii < 0 || ii >= len(receiptHandles) {
+			return nil, errors.New("Malformed response: unknown batch entry id " + entry.Id)
+		}
+
+		faultType := "Receiver"
+		if entry.SenderFault {
+			faultType = "Sender"
+		}
+
+		if failed == nil {
+			failed = make(map[string]error)
+		}
+		failed[receiptHandles[ii]] = &AWSError{
+			Type:      faultType,
+			Code:      entry.Code,
+			Message:   entry.Message,
+			RequestId: response.ResponseMetadata.RequestId,
+		}
+	}
+
+	return failed, nil
+}
+
+// Maximum number of delete batches sent concurrently.
+const maxConcurrentDeleteBatches = 4
+
+// Delete any number of messages from the queue, issuing as many batch
+// requests as required, with up to 4 in flight at once. Returns an
+// error for each message that could not be deleted, keyed by receipt
+// handle, as for DeleteMessageBatch. Messages in a batch whose request
+// failed are reported with that request's error, which is also
+// returned.
+func (q Queue) DeleteMessages(c Context, receiptHandles []string) (failed map[string]error, err error) {
+
+	var mu sync.Mutex
+	fail := func(handle string, handleErr error) {
+		if failed == nil {
+			failed = make(map[string]error)
+		}
+		failed[handle] = handleErr
+	}
+
+	batches := make(chan []string)
+	var wg sync.WaitGroup
+	for ii := 0; ii < maxConcurrentDeleteBatches; ii++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for batch := range batches {
+				batchFailed, batchErr := q.DeleteMessageBatch(c, batch)
+
+				mu.Lock()
+				if batchErr != nil {
+					if err == nil {
+						err = batchErr
+					}
+					for _, handle := range batch {
+						fail(handle, batchErr)
+					}
+				}
+				for handle, handleErr := range batchFailed {
+					fail(handle, handleErr)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for start := 0; start < len(receiptHandles); start += maxBatchEntries {
+		end := start + maxBatchEntries
+		if end > len(receiptHandles) {
+			end = len(receiptHandles)
+		}
+		batches <- receiptHandles[start:end]
+	}
+
+	close(batches)
+	wg.Wait()
+	return failed, err
+}
+
+// Get attributes of the queue. Use "All" to retrieve every attribute.
+func (q Queue) GetAttributes(c Context, names ...string) (map[string]string, error) {
+
+	params := make(url.Values)
+	params.Set("Action", "GetQueueAttributes")
+	params.Set("Version", "2012-11-05")
+	for ii, name := range names {
+		params.Set("AttributeName."+strconv.Itoa(ii+1), name)
+	}
+
+	req, err := http.NewRequest("GET", q.url+"/?"+params.Encode(), nil)
+	if err != nil {
+		return nil, errors.New("Failed to create request: " + err.Error())
+	}
+
+	if err := c.SignRequest(req); err != nil {
+		return nil, err
+	}
+
+	var response struct {
+		GetQueueAttributesResult struct {
+			Attribute []struct {
+				Name  string
+				Value string
+			}
+		}
+	}
+
+	if err := c.call(req, &response); err != nil {
+		return nil, err
+	}
+
+	var attributes map[string]string
+	if len(response.GetQueueAttributesResult.Attribute) > 0 {
+		attributes = make(map[string]string, len(response.GetQueueAttributesResult.Attribute))
+	}
+	for _, attr := range response.GetQueueAttributesResult.Attribute {
+		attributes[attr.Name] = attr.Value
+	}
+
+	return attributes, nil
+}
+
+// Attributes of an SQS queue, parsed into typed values. Attributes not
+// returned by SQS are left as zero values.
+type QueueAttributes struct {
+	QueueArn      string
+	Policy        string
+	RedrivePolicy string
+
+	VisibilityTimeout      time.Duration
+	DelaySeconds           time.Duration
+	MessageRetentionPeriod time.Duration
+	ReceiveWaitTime        time.Duration
 
-	_, err = http.DefaultClient.Do(req)
+	// Maximum message size in bytes.
+	MaximumMessageSize int
+
+	ApproximateNumberOfMessages           int
+	ApproximateNumberOfMessagesNotVisible int
+	ApproximateNumberOfMessagesDelayed    int
+
+	CreatedTimestamp      time.Time
+	LastModifiedTimestamp time.Time
+
+	FifoQueue                 bool
+	ContentBasedDeduplication bool
+}
+
+// Get every attribute of the queue, parsed into typed values.
+func (q Queue) GetTypedAttributes(c Context) (QueueAttributes, error) {
+
+	attributes, err := q.GetAttributes(c, "All")
 	if err != nil {
-		return errors.New("Failed to do request: " + err.Error())
+		return QueueAttributes{}, err
+	}
+
+	qa := QueueAttributes{
+		QueueArn:      attributes["QueueArn"],
+		Policy:        attributes["Policy"],
+		RedrivePolicy: attributes["RedrivePolicy"],
+	}
+
+	durations := map[string]*time.Duration{
+		"VisibilityTimeout":             &qa.VisibilityTimeout,
+		"DelaySeconds":                  &qa.DelaySeconds,
+		"MessageRetentionPeriod":        &qa.MessageRetentionPeriod,
+		"ReceiveMessageWaitTimeSeconds": &qa.ReceiveWaitTime,
+	}
+	counts := map[string]*int{
+		"MaximumMessageSize":                    &qa.MaximumMessageSize,
+		"ApproximateNumberOfMessages":           &qa.ApproximateNumberOfMessages,
+		"ApproximateNumberOfMessagesNotVisible": &qa.ApproximateNumberOfMessagesNotVisible,
+		"ApproximateNumberOfMessagesDelayed":    &qa.ApproximateNumberOfMessagesDelayed,
+	}
+	timestamps := map[string]*time.Time{
+		"CreatedTimestamp":      &qa.CreatedTimestamp,
+		"LastModifiedTimestamp": &qa.LastModifiedTimestamp,
+	}
+	flags := map[string]*bool{
+		"FifoQueue":                 &qa.FifoQueue,
+		"ContentBasedDeduplication": &qa.ContentBasedDeduplication,
+	}
+
+	for name, value := range attributes {
+		var err error
+		if d, ok := durations[name]; ok {
+			var seconds int
+			seconds, err = strconv.Atoi(value)
+			*d = time.Duration(seconds) * time.Second
+		} else if n, ok := counts[name]; ok {
+			*n, err = strconv.Atoi(value)
+		} else if t, ok := timestamps[name]; ok {
+			var seconds int64
+			seconds, err = strconv.ParseInt(value, 10, 64)
+			*t = time.Unix(seconds, 0)
+		} else if f, ok := flags[name]; ok {
+			*f, err = strconv.ParseBool(value)
+		}
+
+		if err != nil {
+			return QueueAttributes{}, errors.New("Malformed attribute " + name + ": " + err.Error())
+		}
+	}
+
+	return qa, nil
+}
+
+// Verify the queue is reachable with the given credentials. Failures
+// are returned as a *PingError.
+func (q Queue) Ping(c Context) error {
+	if _, err := q.GetAttributes(c, "QueueArn"); err != nil {
+		return &PingError{Service: ServiceSQS, Err: err}
 	}
 
 	return nil
 }
+
+// Change the visibility timeout of a received message. The message
+// becomes visible to other consumers after `timeout` has elapsed.
+func (q Queue) ChangeMessageVisibility(c Context, receiptHandle string, timeout time.Duration) error {
+
+	seconds := int(timeout.Seconds())
+	if seconds < 0 || seconds > 43200 {
+		return fmt.Errorf("%w: must be no longer than 12 hours. Got: %d", ErrVisibilityTimeoutRange, seconds)
+	}
+
+	params := make(url.Values)
+	params.Set("Action", "ChangeMessageVisibility")
+	params.Set("ReceiptHandle", receiptHandle)
+	params.Set("VisibilityTimeout", strconv.Itoa(seconds))
+	params.Set("Version", "2012-11-05")
+
+	req, err := http.NewRequest("GET", q.url+"/?"+params.Encode(), nil)
+	if err != nil {
+		return errors.New("Failed to create request: " + err.Error())
+	}
+
+	if err := c.SignRequest(req); err != nil {
+		return err
+	}
+
+	return c.call(req, nil)
+}
+
+// Make a received message immediately visible to other consumers of
+// the queue, e.g. when it cannot be processed by this one.
+func (q Queue) ReleaseMessage(c Context, receiptHandle string) error {
+	return q.ChangeMessageVisibility(c, receiptHandle, 0)
+}
+
+// Keep a received message hidden from other consumers while it is
+// being processed. Every `interval` the message's visibility timeout
+// is extended to `extension` from now, until the returned stop function
+// is called or `ctx` is cancelled.
+//
+// Renewal failures are reported on the returned channel, which is
+// closed once renewal stops. A failed renewal may mean the lease on the
+// message has been lost. Errors are dropped if the channel is not
+// being read.
+func (q Queue) KeepAlive(ctx context.Context, c Context, receiptHandle string, interval, extension time.Duration) (stop func(), errs <-chan error) {
+
+	ctx, cancel := context.WithCancel(ctx)
+	errc := make(chan error, 1)
+
+	go func() {
+		defer close(errc)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			if err := q.ChangeMessageVisibility(c, receiptHandle, extension); err != nil {
+				select {
+				case errc <- err:
+				default:
+				}
+			}
+		}
+	}()
+
+	return cancel, errc
+}
+
+// Delete the queue and any messages in it. Errors such as a missing
+// queue are returned as an *AWSError (e.g. with the code
+// "AWS.SimpleQueueService.NonExistentQueue").
+//
+// Deletion takes up to 60 seconds, during which a queue with the same
+// name cannot be created.
+func (q Queue) Delete(c Context) error {
+
+	params := make(url.Values)
+	params.Set("Action", "DeleteQueue")
+	params.Set("Version", "2012-11-05")
+
+	req, err := http.NewRequest("GET", q.url+"/?"+params.Encode(), nil)
+	if err != nil {
+		return errors.New("Failed to create request: " + err.Error())
+	}
+
+	if err := c.SignRequest(req); err != nil {
+		return err
+	}
+
+	return c.call(req, nil)
+}
+
+// Check whether the queue exists. Returns false only when SQS reports
+// the queue doesn't exist; authorization and connectivity failures are
+// returned as errors since they don't say whether the queue exists.
+func (q Queue) Exists(c Context) (bool, error) {
+
+	_, err := q.GetAttributes(c, "QueueArn")
+	if err == nil {
+		return true, nil
+	}
+
+	var awsErr *AWSError
+	if errors.As(err, &awsErr) {
+		switch awsErr.Code {
+		case "AWS.SimpleQueueService.NonExistentQueue", "QueueDoesNotExist":
+			return false, nil
+		}
+	}
+
+	return false, err
+}
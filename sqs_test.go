@@ -0,0 +1,729 @@
+// Copyright 2012 Matthew Endsley
+// All rights reserved
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted providing that the following conditions
+// are met:
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE AUTHOR ``AS IS'' AND ANY EXPRESS OR
+// IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED.  IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+// OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+// STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+// IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package goaws
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Build the signed receive URL for `opts` and return its query.
+func receiveParams(q Queue, opts ReceiveOptions) (url.Values, error) {
+	rawURL, err := q.ReceiveMessagesURL(NewContext("id", "key"), opts)
+	if err != nil {
+		return nil, err
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	return u.Query(), nil
+}
+
+func TestReceiveRequestAttemptId(t *testing.T) {
+
+	const (
+		fifo     = "https://sqs.us-east-1.amazonaws.com/123456789012/queue.fifo"
+		standard = "https://sqs.us-east-1.amazonaws.com/123456789012/queue"
+	)
+
+	tests := []struct {
+		name     string
+		queueURL string
+		id       string
+		want     string
+		err      bool
+	}{
+		{"fifo", fifo, "attempt-1", "attempt-1", false},
+		{"punctuation", fifo, `!"#$%&'()*+,-./:;<=>?@[\]^_{|}~`, `!"#$%&'()*+,-./:;<=>?@[\]^_{|}~`, false},
+		{"128 characters", fifo, strings.Repeat("a", 128), strings.Repeat("a", 128), false},
+		{"unset", fifo, "", "", false},
+		{"standard queue", standard, "attempt-1", "", false},
+		{"129 characters", fifo, strings.Repeat("a", 129), "", true},
+		{"space", fifo, "attempt 1", "", true},
+		{"non-ASCII", fifo, "attempt-é", "", true},
+	}
+
+	var params url.Values
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		params = r.URL.Query()
+		w.Write([]byte(`<ReceiveMessageResponse><ReceiveMessageResult/></ReceiveMessageResponse>`))
+	}))
+	defer srv.Close()
+
+	for _, tt := range tests {
+		params = nil
+		queueURL := srv.URL + strings.TrimPrefix(tt.queueURL, "https://sqs.us-east-1.amazonaws.com")
+		_, err := NewQueue(queueURL).ReceiveMessagesWithOptions(NewContext("id", "key"), ReceiveOptions{MaxMessages: 1, ReceiveRequestAttemptId: tt.id})
+
+		if tt.err {
+			if !errors.Is(err, ErrInvalidFIFOToken) || params != nil {
+				t.Errorf("%s: error = %v, want ErrInvalidFIFOToken", tt.name, err)
+			}
+			continue
+		} else if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+			continue
+		}
+
+		got, sent := params["ReceiveRequestAttemptId"]
+		if sent != (tt.want != "") || params.Get("ReceiveRequestAttemptId") != tt.want {
+			t.Errorf("%s: ReceiveRequestAttemptId = %q (sent: %v), want %q", tt.name, got, sent, tt.want)
+		}
+	}
+}
+
+func TestDeleteMessageBatch(t *testing.T) {
+
+	const partial = `<DeleteMessageBatchResponse><DeleteMessageBatchResult>
+<DeleteMessageBatchResultEntry><Id>0</Id></DeleteMessageBatchResultEntry>
+<BatchResultErrorEntry><Id>1</Id><Code>ReceiptHandleIsInvalid</Code><Message>invalid</Message><SenderFault>true</SenderFault></BatchResultErrorEntry>
+<BatchResultErrorEntry><Id>2</Id><Code>InternalError</Code><Message>retry</Message><SenderFault>false</SenderFault></BatchResultErrorEntry>
+</DeleteMessageBatchResult><ResponseMetadata><RequestId>request-id</RequestId></ResponseMetadata></DeleteMessageBatchResponse>`
+
+	type entry struct {
+		code      string
+		transient bool
+	}
+
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		err    bool
+		failed map[string]entry
+	}{
+		{"partial failure", http.StatusOK, partial, false, map[string]entry{
+			"b": {"ReceiptHandleIsInvalid", false},
+			"c": {"InternalError", true},
+		}},
+		{"forbidden", http.StatusForbidden, `<ErrorResponse><Error><Type>Sender</Type><Code>AccessDenied</Code></Error></ErrorResponse>`, true, nil},
+		{"unavailable", http.StatusServiceUnavailable, `<ErrorResponse><Error><Type>Receiver</Type><Code>ServiceUnavailable</Code></Error></ErrorResponse>`, true, nil},
+	}
+
+	for _, tt := range tests {
+		q, _ := newTestSQSServer(t, tt.status, tt.body)
+		failed, err := q.DeleteMessageBatch(NewContext("id", "key"), []string{"a", "b", "c"})
+
+		if tt.err {
+			var awsErr *AWSError
+			if !errors.As(err, &awsErr) {
+				t.Errorf("%s: error = %v, want *AWSError", tt.name, err)
+			}
+			continue
+		} else if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+			continue
+		}
+
+		if len(failed) != len(tt.failed) {
+			t.Errorf("%s: failed = %v", tt.name, failed)
+		}
+		for handle, want := range tt.failed {
+			var awsErr *AWSError
+			if !errors.As(failed[handle], &awsErr) || awsErr.Code != want.code {
+				t.Errorf("%s: %s: error = %v, want code %s", tt.name, handle, failed[handle], want.code)
+			} else if IsTransient(failed[handle]) != want.transient {
+				t.Errorf("%s: %s: IsTransient = %v", tt.name, handle, !want.transient)
+			}
+		}
+	}
+}
+
+// Start a server answering every request with `status` and `body`,
+// recording the query parameters and form values of each request.
+func newTestSQSServer(t *testing.T, status int, body string) (Queue, *[]url.Values) {
+
+	var requests []url.Values
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		requests = append(requests, r.Form)
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+
+	return NewQueue(srv.URL + "/123456789012/queue"), &requests
+}
+
+// Start a server answering SQS requests through `handle`, which is
+// passed each request's action and parameters.
+func newTestQueue(t *testing.T, handle func(action string, params url.Values) string) Queue {
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		w.Write([]byte(handle(r.Form.Get("Action"), r.Form)))
+	}))
+	t.Cleanup(srv.Close)
+
+	return NewQueue(srv.URL + "/123456789012/queue")
+}
+
+// Format a ReceiveMessage response holding messages with the given ids.
+// Each message's receipt handle is its id.
+func testReceiveResponse(ids ...string) string {
+	var b strings.Builder
+	b.WriteString(`<ReceiveMessageResponse><ReceiveMessageResult>`)
+	for _, id := range ids {
+		b.WriteString(`<Message><MessageId>` + id + `</MessageId><ReceiptHandle>` + id + `</ReceiptHandle>`)
+		b.WriteString(`<MD5OfBody>` + md5Hex("body") + `</MD5OfBody><Body>body</Body></Message>`)
+	}
+	b.WriteString(`</ReceiveMessageResult></ReceiveMessageResponse>`)
+	return b.String()
+}
+
+func TestDeleteMessages(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		handles int
+
+		// Fail batches containing this receipt handle.
+		failing string
+		failed  int
+	}{
+		{"single batch", 3, "", 0},
+		{"many batches", 45, "", 0},
+		{"failed message", 45, "12", 1},
+	}
+
+	for _, tt := range tests {
+		var mu sync.Mutex
+		active, maxActive := 0, 0
+		deleted := make(map[string]bool)
+		q := newTestQueue(t, func(action string, params url.Values) string {
+			mu.Lock()
+			active++
+			if active > maxActive {
+				maxActive = active
+			}
+			mu.Unlock()
+
+			time.Sleep(20 * time.Millisecond)
+
+			mu.Lock()
+			defer mu.Unlock()
+			active--
+
+			var errors string
+			for ii := 1; params.Get("DeleteMessageBatchRequestEntry."+strconv.Itoa(ii)+".Id") != ""; ii++ {
+				prefix := "DeleteMessageBatchRequestEntry." + strconv.Itoa(ii) + "."
+				if handle := params.Get(prefix + "ReceiptHandle"); handle != tt.failing {
+					deleted[handle] = true
+				} else {
+					errors += `<BatchResultErrorEntry><Id>` + params.Get(prefix+"Id") + `</Id><Code>InternalError</Code><SenderFault>false</SenderFault></BatchResultErrorEntry>`
+				}
+			}
+			if errors != "" {
+				return `<DeleteMessageBatchResponse><DeleteMessageBatchResult>` + errors + `</DeleteMessageBatchResult></DeleteMessageBatchResponse>`
+			}
+			return `<DeleteMessageBatchResponse/>`
+		})
+
+		var handles []string
+		for ii := 0; ii < tt.handles; ii++ {
+			handles = append(handles, strconv.Itoa(ii))
+		}
+
+		failed, err := q.DeleteMessages(NewContext("id", "key"), handles)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+		}
+		if len(failed) != tt.failed || (tt.failing != "" && failed[tt.failing] == nil) {
+			t.Errorf("%s: failed = %v", tt.name, failed)
+		}
+		if len(deleted) != tt.handles-tt.failed {
+			t.Errorf("%s: deleted %d messages, want %d", tt.name, len(deleted), tt.handles-tt.failed)
+		}
+		if want := (tt.handles + maxBatchEntries - 1) / maxBatchEntries; maxActive > maxConcurrentDeleteBatches || (want > 1 && maxActive < 2) {
+			t.Errorf("%s: %d concurrent batches", tt.name, maxActive)
+		}
+	}
+}
+
+func TestSendMessageURLMatchesSend(t *testing.T) {
+
+	msg := SendMessageInput{Body: "a b+c", MessageGroupId: "group"}
+	msg.MessageAttributes = MessageAttributes{}
+	msg.MessageAttributes.SetString("attr", "value")
+
+	q, requests := newTestSQSServer(t, http.StatusOK, `<SendMessageResponse><SendMessageResult>`+
+		`<MD5OfMessageBody>`+md5Hex(msg.Body)+`</MD5OfMessageBody>`+
+		`<MD5OfMessageAttributes>`+msg.MessageAttributes.md5()+`</MD5OfMessageAttributes>`+
+		`</SendMessageResult></SendMessageResponse>`)
+
+	c := NewContext("id", "key")
+	if _, err := q.Send(c, msg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	rawURL, err := q.SendMessageURL(c, msg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sent, query := (*requests)[0], u.Query()
+	for _, params := range []url.Values{sent, query} {
+		params.Del("Signature")
+		params.Del("Timestamp")
+	}
+	if sent.Encode() != query.Encode() {
+		t.Errorf("URL parameters differ from Send:\n%s\n%s", query.Encode(), sent.Encode())
+	}
+}
+
+func TestReceiveVisibilityTimeout(t *testing.T) {
+
+	zero, minute, tooLong := time.Duration(0), time.Minute, 12*time.Hour+time.Second
+	tests := []struct {
+		name    string
+		timeout *time.Duration
+		want    string
+		err     bool
+	}{
+		{"default", nil, "5", false},
+		{"peek", &zero, "0", false},
+		{"minute", &minute, "60", false},
+		{"longer than 12 hours", &tooLong, "", true},
+	}
+
+	for _, tt := range tests {
+		params, err := receiveParams(NewQueue("https://sqs.us-east-1.amazonaws.com/123456789012/queue"), ReceiveOptions{MaxMessages: 1, VisibilityTimeout: tt.timeout})
+
+		if tt.err {
+			if !errors.Is(err, ErrVisibilityTimeoutRange) {
+				t.Errorf("%s: error = %v, want ErrVisibilityTimeoutRange", tt.name, err)
+			}
+			continue
+		} else if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+			continue
+		}
+
+		if got, sent := params["VisibilityTimeout"]; !sent || params.Get("VisibilityTimeout") != tt.want {
+			t.Errorf("%s: VisibilityTimeout = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestEmptyResultsAreNil(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		empty    string
+		nonEmpty string
+		call     func(c Context, q Queue, topic Topic) (interface{}, error)
+	}{
+		{"ReceiveMessages",
+			`<ReceiveMessageResponse><ReceiveMessageResult/></ReceiveMessageResponse>`,
+			testReceiveResponse("id"),
+			func(c Context, q Queue, topic Topic) (interface{}, error) {
+				return q.ReceiveMessages(c, 1, 0)
+			}},
+		{"Queue.GetAttributes",
+			`<GetQueueAttributesResponse><GetQueueAttributesResult/></GetQueueAttributesResponse>`,
+			`<GetQueueAttributesResponse><GetQueueAttributesResult><Attribute><Name>DelaySeconds</Name><Value>0</Value></Attribute></GetQueueAttributesResult></GetQueueAttributesResponse>`,
+			func(c Context, q Queue, topic Topic) (interface{}, error) {
+				return q.GetAttributes(c)
+			}},
+		{"Topic.GetAttributes",
+			`<GetTopicAttributesResponse><GetTopicAttributesResult><Attributes/></GetTopicAttributesResult></GetTopicAttributesResponse>`,
+			`<GetTopicAttributesResponse><GetTopicAttributesResult><Attributes><entry><key>Policy</key><value>{}</value></entry></Attributes></GetTopicAttributesResult></GetTopicAttributesResponse>`,
+			func(c Context, q Queue, topic Topic) (interface{}, error) {
+				return topic.GetAttributes(c)
+			}},
+		{"Topic.GetSubscriptionAttributes",
+			`<GetSubscriptionAttributesResponse><GetSubscriptionAttributesResult><Attributes/></GetSubscriptionAttributesResult></GetSubscriptionAttributesResponse>`,
+			`<GetSubscriptionAttributesResponse><GetSubscriptionAttributesResult><Attributes><entry><key>Protocol</key><value>sqs</value></entry></Attributes></GetSubscriptionAttributesResult></GetSubscriptionAttributesResponse>`,
+			func(c Context, q Queue, topic Topic) (interface{}, error) {
+				return topic.GetSubscriptionAttributes(c, "arn:aws:sns:us-east-1:123456789012:topic:subscription")
+			}},
+	}
+
+	for _, tt := range tests {
+		for _, body := range []string{tt.empty, tt.nonEmpty} {
+			q, _ := newTestSQSServer(t, http.StatusOK, body)
+			topic, _ := newTestSNSServer(t, body)
+
+			result, err := tt.call(NewContext("id", "key"), q, topic)
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", tt.name, err)
+				continue
+			}
+
+			v := reflect.ValueOf(result)
+			if body == tt.empty && !v.IsNil() {
+				t.Errorf("%s: empty result is %#v, want nil", tt.name, result)
+			} else if body == tt.nonEmpty && v.Len() != 1 {
+				t.Errorf("%s: result = %#v, want one entry", tt.name, result)
+			}
+		}
+	}
+}
+
+func TestNewQueueNormalizesURL(t *testing.T) {
+
+	const want = "https://sqs.us-east-1.amazonaws.com/123456789012/queue"
+	tests := []struct {
+		name     string
+		queueURL string
+		want     string
+	}{
+		{"canonical", want, want},
+		{"trailing slash", want + "/", want},
+		{"trailing slashes", want + "//", want},
+		{"no scheme", "sqs.us-east-1.amazonaws.com/123456789012/queue", want},
+		{"no scheme, trailing slash", "sqs.us-east-1.amazonaws.com/123456789012/queue/", want},
+		{"http", "http://localhost:9324/queue/", "http://localhost:9324/queue"},
+	}
+
+	for _, tt := range tests {
+		q := NewQueue(tt.queueURL)
+		if q.URL() != tt.want {
+			t.Errorf("%s: URL = %q, want %q", tt.name, q.URL(), tt.want)
+		}
+
+		rawURL, err := q.ReceiveMessagesURL(NewContext("id", "key"), ReceiveOptions{MaxMessages: 1})
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+			continue
+		}
+
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			t.Errorf("%s: malformed request URL: %v", tt.name, err)
+		} else if u.Scheme+"://"+u.Host+strings.TrimSuffix(u.Path, "/") != tt.want || u.Query().Get("Signature") == "" {
+			t.Errorf("%s: request URL = %q", tt.name, rawURL)
+		}
+	}
+}
+
+func TestReceiveMaxMessages(t *testing.T) {
+
+	tests := []struct {
+		name string
+		max  int
+		err  bool
+	}{
+		{"zero", 0, false},
+		{"one", 1, false},
+		{"limit", MaxReceiveMessages, false},
+		{"over the limit", MaxReceiveMessages + 1, true},
+		{"negative", -1, true},
+	}
+
+	for _, tt := range tests {
+		params, err := receiveParams(NewQueue("https://sqs.us-east-1.amazonaws.com/123456789012/queue"), ReceiveOptions{MaxMessages: tt.max})
+
+		if tt.err {
+			if !errors.Is(err, ErrMaxMessagesRange) || !strings.Contains(err.Error(), strconv.Itoa(tt.max)) {
+				t.Errorf("%s: error = %v, want ErrMaxMessagesRange naming %d", tt.name, err, tt.max)
+			}
+		} else if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+		} else if got := params.Get("MaxNumberOfMessages"); got != strconv.Itoa(tt.max) {
+			t.Errorf("%s: MaxNumberOfMessages = %q", tt.name, got)
+		}
+	}
+}
+
+func TestReceiveOmitVisibilityTimeout(t *testing.T) {
+
+	zero := time.Duration(0)
+	tests := []struct {
+		name string
+		opts ReceiveOptions
+		sent bool
+	}{
+		{"default", ReceiveOptions{}, true},
+		{"zero", ReceiveOptions{VisibilityTimeout: &zero}, true},
+		{"omitted", ReceiveOptions{OmitVisibilityTimeout: true}, false},
+		{"omitted with timeout", ReceiveOptions{OmitVisibilityTimeout: true, VisibilityTimeout: &zero}, false},
+	}
+
+	for _, tt := range tests {
+		params, err := receiveParams(NewQueue("https://sqs.us-east-1.amazonaws.com/123456789012/queue"), tt.opts)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+		} else if _, sent := params["VisibilityTimeout"]; sent != tt.sent {
+			t.Errorf("%s: VisibilityTimeout sent: %v, want %v", tt.name, sent, tt.sent)
+		}
+	}
+}
+
+func TestSendVerifiesMessageAttributes(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		digest string
+		err    bool
+	}{
+		{"matching digest", "da1b33cc3cbfe8b1630921e78e6b9880", false},
+		{"mismatched digest", "00000000000000000000000000000000", true},
+		{"missing digest", "", true},
+	}
+
+	for _, tt := range tests {
+		q, requests := newTestSQSServer(t, http.StatusOK, `<SendMessageResponse><SendMessageResult><MessageId>message-id</MessageId>`+
+			`<MD5OfMessageBody>841a2d689ad86bd1611447453c22c6fc</MD5OfMessageBody>`+
+			`<MD5OfMessageAttributes>`+tt.digest+`</MD5OfMessageAttributes></SendMessageResult></SendMessageResponse>`)
+
+		msg := SendMessageInput{Body: "body", MessageAttributes: MessageAttributes{}}
+		msg.MessageAttributes.SetString("color", "blue")
+		_, err := q.Send(NewContext("id", "key"), msg)
+
+		if tt.err {
+			if !errors.Is(err, ErrMD5Mismatch) {
+				t.Errorf("%s: error = %v, want ErrMD5Mismatch", tt.name, err)
+			}
+		} else if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+		}
+
+		params := (*requests)[0]
+		if params.Get("MessageAttribute.1.Name") != "color" || params.Get("MessageAttribute.1.Value.StringValue") != "blue" {
+			t.Errorf("%s: attributes not sent: %v", tt.name, params)
+		}
+	}
+}
+
+const testReceiptHandleError = `<ErrorResponse><Error><Type>Sender</Type><Code>ReceiptHandleIsInvalid</Code><Message>The input receipt handle is invalid.</Message></Error><RequestId>request-id</RequestId></ErrorResponse>`
+
+func TestReceiveVerifiesMessageAttributes(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		digest string
+		skip   bool
+		err    bool
+	}{
+		{"matching digest", "da1b33cc3cbfe8b1630921e78e6b9880", false, false},
+		{"mismatched digest", "00000000000000000000000000000000", false, true},
+		{"missing digest", "", false, true},
+		{"skipped verification", "00000000000000000000000000000000", true, false},
+	}
+
+	for _, tt := range tests {
+		q, _ := newTestSQSServer(t, http.StatusOK, `<ReceiveMessageResponse><ReceiveMessageResult><Message>`+
+			`<MessageId>message-id</MessageId><ReceiptHandle>handle</ReceiptHandle>`+
+			`<MD5OfBody>841a2d689ad86bd1611447453c22c6fc</MD5OfBody><Body>body</Body>`+
+			`<MD5OfMessageAttributes>`+tt.digest+`</MD5OfMessageAttributes>`+
+			`<MessageAttribute><Name>color</Name><Value><DataType>String</DataType><StringValue>blue</StringValue></Value></MessageAttribute>`+
+			`</Message></ReceiveMessageResult></ReceiveMessageResponse>`)
+
+		messages, err := q.ReceiveMessagesWithOptions(NewContext("id", "key"), ReceiveOptions{
+			MaxMessages:         1,
+			SkipMD5Verification: tt.skip,
+		})
+
+		if tt.err {
+			if !errors.Is(err, ErrMD5Mismatch) {
+				t.Errorf("%s: error = %v, want ErrMD5Mismatch", tt.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+		} else if len(messages) != 1 || messages[0].MessageAttributes["color"].StringValue != "blue" {
+			t.Errorf("%s: messages = %+v", tt.name, messages)
+		}
+	}
+}
+
+func TestDeleteReceived(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		code   string
+	}{
+		{"deleted", http.StatusOK, `<DeleteMessageResponse/>`, ""},
+		{"invalid receipt handle", http.StatusBadRequest, testReceiptHandleError, "ReceiptHandleIsInvalid"},
+		{"server error", http.StatusInternalServerError, `<ErrorResponse><Error><Type>Receiver</Type><Code>InternalError</Code></Error></ErrorResponse>`, "InternalError"},
+	}
+
+	for _, tt := range tests {
+		q, requests := newTestSQSServer(t, tt.status, tt.body)
+		err := q.DeleteReceived(NewContext("id", "key"), SQSMessage{MessageId: "message-id", ReceiptHandle: "handle"})
+
+		if tt.code == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", tt.name, err)
+			}
+		} else {
+			var awsErr *AWSError
+			if !errors.As(err, &awsErr) || awsErr.Code != tt.code {
+				t.Errorf("%s: error = %v, want code %s", tt.name, err, tt.code)
+			} else if !strings.Contains(err.Error(), "message-id") {
+				t.Errorf("%s: error does not identify the message: %v", tt.name, err)
+			}
+		}
+
+		if len(*requests) != 1 {
+			t.Fatalf("%s: sent %d requests", tt.name, len(*requests))
+		}
+		if v := (*requests)[0].Get("Version"); v != "2012-11-05" {
+			t.Errorf("%s: Version = %s", tt.name, v)
+		}
+	}
+}
+
+func TestSendMessageBatch(t *testing.T) {
+
+	msgs := []SendMessageInput{{Body: "sent"}, {Body: "throttled"}, {Body: "invalid"}, {Body: "mismatched"}, {Body: "missing"}}
+
+	q, _ := newTestSQSServer(t, http.StatusOK, `<SendMessageBatchResponse><SendMessageBatchResult>`+
+		`<SendMessageBatchResultEntry><Id>0</Id><MessageId>id-0</MessageId><MD5OfMessageBody>`+md5Hex("sent")+`</MD5OfMessageBody></SendMessageBatchResultEntry>`+
+		`<SendMessageBatchResultEntry><Id>3</Id><MessageId>id-3</MessageId><MD5OfMessageBody>`+md5Hex("other")+`</MD5OfMessageBody></SendMessageBatchResultEntry>`+
+		`<BatchResultErrorEntry><Id>1</Id><Code>ThrottlingException</Code><Message>slow down</Message><SenderFault>false</SenderFault></BatchResultErrorEntry>`+
+		`<BatchResultErrorEntry><Id>2</Id><Code>InvalidMessageContents</Code><SenderFault>true</SenderFault></BatchResultErrorEntry>`+
+		`</SendMessageBatchResult><ResponseMetadata><RequestId>request-id</RequestId></ResponseMetadata></SendMessageBatchResponse>`)
+
+	results, failed, err := q.SendMessageBatch(NewContext("id", "key"), msgs)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(results) != len(msgs) || results[0].MessageId != "id-0" || results[0].RequestId != "request-id" {
+		t.Errorf("results = %+v", results)
+	}
+	if _, ok := failed[0]; ok || len(failed) != 4 {
+		t.Errorf("failed = %v, want messages 1-4", failed)
+	}
+
+	var awsErr *AWSError
+	if !errors.As(failed[1], &awsErr) || awsErr.Code != "ThrottlingException" || !IsTransient(failed[1]) {
+		t.Errorf("failed[1] = %v, want a transient *AWSError", failed[1])
+	}
+	if !errors.As(failed[2], &awsErr) || awsErr.Type != "Sender" || IsTransient(failed[2]) {
+		t.Errorf("failed[2] = %v, want a permanent *AWSError", failed[2])
+	}
+	if !errors.Is(failed[3], ErrMD5Mismatch) {
+		t.Errorf("failed[3] = %v, want ErrMD5Mismatch", failed[3])
+	}
+	if failed[4] == nil {
+		t.Errorf("message missing from the response not reported as failed")
+	}
+}
+
+func TestReceiveSystemAttributes(t *testing.T) {
+
+	const trace = "Root=1-5759e988-bd862e3fe1be46a994272793;Sampled=1"
+	const response = `<ReceiveMessageResponse><ReceiveMessageResult><Message>
+<MessageId>message-id</MessageId><ReceiptHandle>handle</ReceiptHandle>
+<MD5OfBody>841a2d689ad86bd1611447453c22c6fc</MD5OfBody><Body>body</Body>
+<Attribute><Name>AWSTraceHeader</Name><Value>` + trace + `</Value></Attribute>
+<Attribute><Name>SentTimestamp</Name><Value>1700000000000</Value></Attribute>
+<MD5OfMessageAttributes>5d5cc2c23a738aa4bedf4dfa9a672013</MD5OfMessageAttributes>
+<MessageAttribute><Name>AWSTraceHeader</Name><Value><DataType>String</DataType><StringValue>user-value</StringValue></Value></MessageAttribute>
+</Message></ReceiveMessageResult></ReceiveMessageResponse>`
+
+	q, _ := newTestSQSServer(t, http.StatusOK, response)
+	messages, err := q.ReceiveMessagesWithOptions(NewContext("id", "key"), ReceiveOptions{
+		MaxMessages:           1,
+		AttributeNames:        []string{"All"},
+		MessageAttributeNames: []string{"All"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	} else if len(messages) != 1 {
+		t.Fatalf("received %d messages", len(messages))
+	}
+
+	msg := messages[0]
+	tests := []struct {
+		name string
+		got  string
+		want string
+	}{
+		{"system AWSTraceHeader", msg.SystemAttributes["AWSTraceHeader"], trace},
+		{"system SentTimestamp", msg.SystemAttributes["SentTimestamp"], "1700000000000"},
+		{"AWSTraceHeader field", msg.AWSTraceHeader, trace},
+		{"user AWSTraceHeader", msg.MessageAttributes["AWSTraceHeader"].StringValue, "user-value"},
+	}
+
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.name, tt.got, tt.want)
+		}
+	}
+
+	if len(msg.SystemAttributes) != 2 || len(msg.MessageAttributes) != 1 {
+		t.Errorf("system attributes = %v, message attributes = %v", msg.SystemAttributes, msg.MessageAttributes)
+	}
+}
+
+func TestSendVerifiesSystemAttributes(t *testing.T) {
+
+	const trace = "Root=1-5759e988-bd862e3fe1be46a994272793;Sampled=1"
+	tests := []struct {
+		name   string
+		digest string
+		err    bool
+	}{
+		{"matching digest", "5f48eef650c1d0207456969c85af2fdd", false},
+		{"mismatched digest", "00000000000000000000000000000000", true},
+		{"missing digest", "", true},
+	}
+
+	for _, tt := range tests {
+		q, requests := newTestSQSServer(t, http.StatusOK, `<SendMessageResponse><SendMessageResult><MessageId>message-id</MessageId>`+
+			`<MD5OfMessageBody>841a2d689ad86bd1611447453c22c6fc</MD5OfMessageBody>`+
+			`<MD5OfMessageSystemAttributes>`+tt.digest+`</MD5OfMessageSystemAttributes></SendMessageResult></SendMessageResponse>`)
+		result, err := q.Send(NewContext("id", "key"), SendMessageInput{Body: "body", AWSTraceHeader: trace})
+
+		if tt.err {
+			if !errors.Is(err, ErrMD5Mismatch) {
+				t.Errorf("%s: error = %v, want ErrMD5Mismatch", tt.name, err)
+			}
+		} else if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+		} else if result.MD5OfMessageSystemAttributes != tt.digest {
+			t.Errorf("%s: MD5OfMessageSystemAttributes = %q", tt.name, result.MD5OfMessageSystemAttributes)
+		}
+
+		params := (*requests)[0]
+		if params.Get("MessageSystemAttribute.1.Name") != "AWSTraceHeader" || params.Get("MessageSystemAttribute.1.Value.StringValue") != trace {
+			t.Errorf("%s: system attributes not sent: %v", tt.name, params)
+		}
+		if _, sent := params["MessageAttribute.1.Name"]; sent {
+			t.Errorf("%s: system attributes sent as message attributes: %v", tt.name, params)
+		}
+	}
+}